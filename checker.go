@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -11,9 +12,29 @@ type ResourceChecker interface {
 }
 
 type UnhealthyChild struct {
-	Kind    string `json:"kind"`
-	Name    string `json:"name"`
-	Status  string `json:"status"`
-	Message string `json:"issue,omitempty"`
-	Reason  string `json:"reason,omitempty"`
+	Kind    string    `json:"kind"`
+	Name    string    `json:"name"`
+	UID     types.UID `json:"uid,omitempty"`
+	Status  string    `json:"status"`
+	Message string    `json:"issue,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+
+	EventReason      string                `json:"eventReason,omitempty"`
+	EventMessage     string                `json:"eventMessage,omitempty"`
+	Termination      *ContainerTermination `json:"termination,omitempty"`
+	SchedulingCauses []string              `json:"schedulingCauses,omitempty"`
+	Optional         bool                  `json:"optional,omitempty"`
+}
+
+// countBlockingChildren returns the number of children that keep the custom
+// resource from being reported as ready. Degraded and optional children are
+// informational.
+func countBlockingChildren(children []UnhealthyChild) int {
+	count := 0
+	for _, child := range children {
+		if child.Status != "Degraded" && !child.Optional {
+			count++
+		}
+	}
+	return count
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+type CronJobChecker struct {
+	// MissedSchedules is the number of schedule periods without a successful
+	// run after which a CronJob is considered failed.
+	MissedSchedules int
+	// AllowSuspended accepts suspended CronJobs as healthy.
+	AllowSuspended bool
+}
+
+func (cc CronJobChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
+	cronJobs, err := listCronJobs(ctx, clientset, namespace, labelSelector)
+	if err != nil {
+		return fmt.Errorf("error listing CronJobs: %v", err)
+	}
+
+	var latestJobs map[types.UID]*batchv1.Job
+	for _, cronJob := range cronJobs {
+		if !isSelected(ctx, &cronJob, annotationSelector) {
+			continue
+		}
+		log.Printf("[INFO] CronJob status: name=%s, schedule=%s, active=%d, lastScheduleTime=%v, lastSuccessfulTime=%v",
+			cronJob.Name, cronJob.Spec.Schedule, len(cronJob.Status.Active), cronJob.Status.LastScheduleTime, cronJob.Status.LastSuccessfulTime)
+
+		if cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend {
+			if cc.AllowSuspended {
+				log.Printf("[INFO] CronJob %s is suspended", cronJob.Name)
+				continue
+			}
+			appendCronJobFailure(unhealthyChildren, overallStatus, cronJob, fmt.Sprintf("CronJob %s is suspended", cronJob.Name), "Suspended")
+			continue
+		}
+
+		if latestJobs == nil {
+			latestJobs, err = getLatestCronJobJobs(ctx, clientset, namespace)
+			if err != nil {
+				return err
+			}
+		}
+		lastJob := latestJobs[cronJob.UID]
+		if lastJob != nil && isJobConditionTrue(*lastJob, batchv1.JobFailed) {
+			appendCronJobFailure(unhealthyChildren, overallStatus, cronJob,
+				fmt.Sprintf("CronJob %s most recent Job %s failed", cronJob.Name, lastJob.Name), getJobFailureReason(*lastJob))
+			continue
+		}
+
+		period, err := getCronJobSchedulePeriod(cronJob)
+		if err != nil {
+			appendCronJobFailure(unhealthyChildren, overallStatus, cronJob,
+				fmt.Sprintf("CronJob %s has an invalid schedule %q: %v", cronJob.Name, cronJob.Spec.Schedule, err), "InvalidSchedule")
+			continue
+		}
+		lastSuccess := cronJob.CreationTimestamp.Time
+		if cronJob.Status.LastSuccessfulTime != nil {
+			lastSuccess = cronJob.Status.LastSuccessfulTime.Time
+		}
+		if cc.MissedSchedules > 0 && time.Since(lastSuccess) > time.Duration(cc.MissedSchedules)*period {
+			appendCronJobFailure(unhealthyChildren, overallStatus, cronJob,
+				fmt.Sprintf("CronJob %s has not succeeded since %s (more than %d schedule periods of %v)", cronJob.Name, lastSuccess.Format(time.RFC3339), cc.MissedSchedules, period),
+				"MissedSchedule")
+			continue
+		}
+
+		log.Printf("[INFO] CronJob %s is Healthy", cronJob.Name)
+	}
+
+	return nil
+}
+
+func appendCronJobFailure(unhealthyChildren *[]UnhealthyChild, overallStatus *string, cronJob batchv1.CronJob, message, reason string) {
+	*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+		Kind:    "CronJob",
+		Name:    cronJob.Name,
+		UID:     cronJob.UID,
+		Status:  "Failed",
+		Message: message,
+		Reason:  reason,
+	})
+	*overallStatus = "failed"
+}
+
+// getLatestCronJobJobs lists the Jobs of the namespace once and returns the
+// most recently created Job of each CronJob, keyed by the CronJob's UID.
+func getLatestCronJobJobs(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (map[types.UID]*batchv1.Job, error) {
+	jobs, err := listJobs(ctx, clientset, namespace, "")
+	if err != nil {
+		return nil, fmt.Errorf("error listing Jobs of CronJobs: %v", err)
+	}
+
+	latest := make(map[types.UID]*batchv1.Job)
+	for i := range jobs {
+		owner := metav1.GetControllerOf(&jobs[i])
+		if owner == nil || owner.Kind != "CronJob" {
+			continue
+		}
+		if current, exists := latest[owner.UID]; !exists || jobs[i].CreationTimestamp.After(current.CreationTimestamp.Time) {
+			latest[owner.UID] = &jobs[i]
+		}
+	}
+	return latest, nil
+}
+
+// getCronJobSchedulePeriod approximates the schedule period as the gap between
+// the next two scheduled runs.
+func getCronJobSchedulePeriod(cronJob batchv1.CronJob) (time.Duration, error) {
+	spec := cronJob.Spec.Schedule
+	if cronJob.Spec.TimeZone != nil {
+		spec = fmt.Sprintf("CRON_TZ=%s %s", *cronJob.Spec.TimeZone, spec)
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return 0, err
+	}
+	next := schedule.Next(time.Now())
+	return schedule.Next(next).Sub(next), nil
+}
+
+func isJobConditionTrue(job batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func isOwnedByCronJob(job batchv1.Job) bool {
+	owner := metav1.GetControllerOf(&job)
+	return owner != nil && owner.Kind == "CronJob"
+}
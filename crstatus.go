@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// crCondition is the subset of a metav1.Condition read from the custom
+// resource's status.
+type crCondition struct {
+	Type    string
+	Status  string
+	Reason  string
+	Message string
+}
+
+var (
+	failedPhases    = map[string]struct{}{"failed": {}, "error": {}, "degraded": {}}
+	deployingPhases = map[string]struct{}{"pending": {}, "progressing": {}, "creating": {}, "provisioning": {}, "deploying": {}, "initializing": {}, "updating": {}, "reconciling": {}}
+)
+
+// evaluateCustomResource derives a verdict from what the operator itself
+// publishes in the custom resource's status. An empty status means the custom
+// resource does not hold back a "ready" verdict.
+func evaluateCustomResource(cr unstructured.Unstructured) (status, reason, message string) {
+	generation := cr.GetGeneration()
+	observedGeneration, found, _ := unstructured.NestedInt64(cr.Object, "status", "observedGeneration")
+	if found && generation > 0 && observedGeneration < generation {
+		return "deploying", "GenerationNotObserved", fmt.Sprintf("Operator has observed generation %d of %d", observedGeneration, generation)
+	}
+
+	conditions := getCustomResourceConditions(cr)
+	if condition, exists := conditions["Degraded"]; exists && condition.Status == "True" {
+		return "failed", condition.Reason, formatCondition(condition)
+	}
+	for _, conditionType := range []string{"Ready", "Available"} {
+		if condition, exists := conditions[conditionType]; exists && condition.Status != "True" {
+			return "deploying", condition.Reason, formatCondition(condition)
+		}
+	}
+
+	phase, _, _ := unstructured.NestedString(cr.Object, "status", "phase")
+	if _, failed := failedPhases[strings.ToLower(phase)]; failed {
+		return "failed", phase, fmt.Sprintf("Custom resource is in phase %s", phase)
+	}
+	if _, deploying := deployingPhases[strings.ToLower(phase)]; deploying {
+		return "deploying", phase, fmt.Sprintf("Custom resource is in phase %s", phase)
+	}
+	return "", "", ""
+}
+
+func getCustomResourceConditions(cr unstructured.Unstructured) map[string]crCondition {
+	conditions := make(map[string]crCondition)
+	items, _, _ := unstructured.NestedSlice(cr.Object, "status", "conditions")
+	for _, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		condition := crCondition{}
+		condition.Type, _, _ = unstructured.NestedString(fields, "type")
+		condition.Status, _, _ = unstructured.NestedString(fields, "status")
+		condition.Reason, _, _ = unstructured.NestedString(fields, "reason")
+		condition.Message, _, _ = unstructured.NestedString(fields, "message")
+		if condition.Type != "" {
+			conditions[condition.Type] = condition
+		}
+	}
+	return conditions
+}
+
+func formatCondition(condition crCondition) string {
+	message := fmt.Sprintf("%s=%s", condition.Type, condition.Status)
+	if condition.Reason != "" {
+		message = fmt.Sprintf("%s (%s)", message, condition.Reason)
+	}
+	if condition.Message != "" {
+		message = fmt.Sprintf("%s: %s", message, condition.Message)
+	}
+	return message
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestEvaluateCustomResource(t *testing.T) {
+	tests := []struct {
+		name       string
+		json       string
+		wantStatus string
+		wantReason string
+	}{
+		{
+			name:       "no status",
+			json:       `{"apiVersion":"example.com/v1","kind":"Database","metadata":{"name":"db","generation":1}}`,
+			wantStatus: "",
+		},
+		{
+			name:       "generation not observed",
+			json:       `{"apiVersion":"example.com/v1","kind":"Database","metadata":{"name":"db","generation":3},"status":{"observedGeneration":2}}`,
+			wantStatus: "deploying",
+			wantReason: "GenerationNotObserved",
+		},
+		{
+			name:       "generation observed",
+			json:       `{"apiVersion":"example.com/v1","kind":"Database","metadata":{"name":"db","generation":3},"status":{"observedGeneration":3}}`,
+			wantStatus: "",
+		},
+		{
+			name:       "degraded condition",
+			json:       `{"apiVersion":"example.com/v1","kind":"Database","metadata":{"name":"db"},"status":{"conditions":[{"type":"Ready","status":"True"},{"type":"Degraded","status":"True","reason":"BackupFailed"}]}}`,
+			wantStatus: "failed",
+			wantReason: "BackupFailed",
+		},
+		{
+			name:       "ready condition false",
+			json:       `{"apiVersion":"example.com/v1","kind":"Database","metadata":{"name":"db"},"status":{"conditions":[{"type":"Ready","status":"False","reason":"Provisioning"}]}}`,
+			wantStatus: "deploying",
+			wantReason: "Provisioning",
+		},
+		{
+			name:       "available condition unknown",
+			json:       `{"apiVersion":"example.com/v1","kind":"Database","metadata":{"name":"db"},"status":{"conditions":[{"type":"Available","status":"Unknown","reason":"Pending"}]}}`,
+			wantStatus: "deploying",
+			wantReason: "Pending",
+		},
+		{
+			name:       "ready conditions true",
+			json:       `{"apiVersion":"example.com/v1","kind":"Database","metadata":{"name":"db"},"status":{"conditions":[{"type":"Ready","status":"True"},{"type":"Available","status":"True"}]}}`,
+			wantStatus: "",
+		},
+		{
+			name:       "failed phase",
+			json:       `{"apiVersion":"example.com/v1","kind":"Database","metadata":{"name":"db"},"status":{"phase":"Failed"}}`,
+			wantStatus: "failed",
+			wantReason: "Failed",
+		},
+		{
+			name:       "deploying phase",
+			json:       `{"apiVersion":"example.com/v1","kind":"Database","metadata":{"name":"db"},"status":{"phase":"Provisioning"}}`,
+			wantStatus: "deploying",
+			wantReason: "Provisioning",
+		},
+		{
+			name:       "running phase",
+			json:       `{"apiVersion":"example.com/v1","kind":"Database","metadata":{"name":"db"},"status":{"phase":"Running"}}`,
+			wantStatus: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cr unstructured.Unstructured
+			if err := cr.UnmarshalJSON([]byte(tt.json)); err != nil {
+				t.Fatalf("error decoding custom resource: %v", err)
+			}
+			status, reason, _ := evaluateCustomResource(cr)
+			if status != tt.wantStatus || reason != tt.wantReason {
+				t.Errorf("evaluateCustomResource() = (%q, %q), want (%q, %q)", status, reason, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+type DaemonSetChecker struct{}
+
+func (dsc DaemonSetChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
+	daemonSets, err := listDaemonSets(ctx, clientset, namespace, labelSelector)
+	if err != nil {
+		return fmt.Errorf("error listing DaemonSets: %v", err)
+	}
+
+	for _, ds := range daemonSets {
+		if !isSelected(ctx, &ds, annotationSelector) {
+			continue
+		}
+		status := ds.Status
+		log.Printf("[INFO] DaemonSet status: name=%s, desired=%d, ready=%d, updated=%d, misscheduled=%d",
+			ds.Name, status.DesiredNumberScheduled, status.NumberReady, status.UpdatedNumberScheduled, status.NumberMisscheduled)
+
+		var message, reason string
+		switch {
+		case status.ObservedGeneration < ds.Generation:
+			message = fmt.Sprintf("DaemonSet %s spec update not yet observed by the controller", ds.Name)
+			reason = "GenerationNotObserved"
+		case status.NumberReady < status.DesiredNumberScheduled:
+			missing, err := getNodesMissingDaemonPod(ctx, clientset, ds)
+			if err != nil {
+				return err
+			}
+			message = fmt.Sprintf("DaemonSet %s has %d of %d nodes ready", ds.Name, status.NumberReady, status.DesiredNumberScheduled)
+			if len(missing) > 0 {
+				message = fmt.Sprintf("%s, missing a ready pod on: %s", message, strings.Join(missing, ", "))
+			}
+			reason = "NodesNotReady"
+		case status.UpdatedNumberScheduled < status.DesiredNumberScheduled:
+			message = fmt.Sprintf("DaemonSet %s rollout in progress: %d of %d nodes updated", ds.Name, status.UpdatedNumberScheduled, status.DesiredNumberScheduled)
+			reason = "RollingOut"
+		case status.NumberMisscheduled > 0:
+			message = fmt.Sprintf("DaemonSet %s has %d pods running on nodes they should not run on", ds.Name, status.NumberMisscheduled)
+			reason = "Misscheduled"
+		}
+
+		if reason == "" {
+			log.Printf("[INFO] DaemonSet %s is Healthy", ds.Name)
+			continue
+		}
+
+		*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+			Kind:    "DaemonSet",
+			Name:    ds.Name,
+			UID:     ds.UID,
+			Status:  "Progressing",
+			Message: message,
+			Reason:  reason,
+		})
+		if *overallStatus != "failed" {
+			*overallStatus = "deploying"
+		}
+	}
+
+	return nil
+}
+
+// getNodesMissingDaemonPod lists the eligible nodes that have no ready Pod of
+// the DaemonSet. Eligibility only considers the node selector and taints, so
+// nodes excluded purely through node affinity may show up here as well.
+func getNodesMissingDaemonPod(ctx context.Context, clientset *kubernetes.Clientset, ds appsv1.DaemonSet) ([]string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing selector of DaemonSet %s: %v", ds.Name, err)
+	}
+	pods, err := listPods(ctx, clientset, ds.Namespace, selector.String())
+	if err != nil {
+		return nil, fmt.Errorf("error listing Pods of DaemonSet %s: %v", ds.Name, err)
+	}
+	podsByNode := make(map[string]corev1.Pod)
+	for _, pod := range pods {
+		owner := metav1.GetControllerOf(&pod)
+		if owner == nil || owner.UID != ds.UID || pod.Spec.NodeName == "" {
+			continue
+		}
+		podsByNode[pod.Spec.NodeName] = pod
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(ds.Spec.Template.Spec.NodeSelector).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing Nodes: %v", err)
+	}
+
+	tolerations := append(append([]corev1.Toleration{}, ds.Spec.Template.Spec.Tolerations...), daemonSetDefaultTolerations...)
+	var missing []string
+	for _, node := range nodes.Items {
+		if !toleratesNodeTaints(tolerations, node.Spec.Taints) {
+			continue
+		}
+		pod, exists := podsByNode[node.Name]
+		if !exists {
+			missing = append(missing, fmt.Sprintf("%s (no pod)", node.Name))
+		} else if pod.Status.Phase != corev1.PodRunning || !isPodHealthy(pod) {
+			missing = append(missing, fmt.Sprintf("%s (pod %s %s)", node.Name, pod.Name, pod.Status.Phase))
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// daemonSetDefaultTolerations are added to every DaemonSet Pod by the controller.
+var daemonSetDefaultTolerations = []corev1.Toleration{
+	{Key: corev1.TaintNodeNotReady, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+	{Key: corev1.TaintNodeUnreachable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+	{Key: corev1.TaintNodeDiskPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodeMemoryPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodePIDPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodeUnschedulable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+}
+
+func toleratesNodeTaints(tolerations []corev1.Toleration, taints []corev1.Taint) bool {
+	for i := range taints {
+		if taints[i].Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for j := range tolerations {
+			if tolerations[j].ToleratesTaint(&taints[i]) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type DeploymentChecker struct{}
+
+func (dc DeploymentChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
+	deployments, err := listDeployments(ctx, clientset, namespace, labelSelector)
+	if err != nil {
+		return fmt.Errorf("error listing Deployments: %v", err)
+	}
+
+	for _, deployment := range deployments {
+		if !isSelected(ctx, &deployment, annotationSelector) {
+			continue
+		}
+		desired := int32(1)
+		if deployment.Spec.Replicas != nil {
+			desired = *deployment.Spec.Replicas
+		}
+		log.Printf("[INFO] Deployment status: name=%s, desired=%d, updated=%d, available=%d, observedGeneration=%d, generation=%d",
+			deployment.Name, desired, deployment.Status.UpdatedReplicas, deployment.Status.AvailableReplicas, deployment.Status.ObservedGeneration, deployment.Generation)
+
+		// A rollout past its progress deadline will not recover on its own
+		progressing := getDeploymentCondition(deployment, appsv1.DeploymentProgressing)
+		if progressing != nil && progressing.Reason == "ProgressDeadlineExceeded" {
+			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+				Kind:    "Deployment",
+				Name:    deployment.Name,
+				UID:     deployment.UID,
+				Status:  "Failed",
+				Message: fmt.Sprintf("Deployment %s exceeded its progress deadline: %s", deployment.Name, progressing.Message),
+				Reason:  progressing.Reason,
+			})
+			*overallStatus = "failed"
+			continue
+		}
+
+		var message, reason string
+		switch {
+		case deployment.Status.ObservedGeneration < deployment.Generation:
+			message = fmt.Sprintf("Deployment %s spec update not yet observed by the controller", deployment.Name)
+			reason = "GenerationNotObserved"
+		case deployment.Status.UpdatedReplicas < desired:
+			message = fmt.Sprintf("Deployment %s rollout in progress: %d of %d replicas updated", deployment.Name, deployment.Status.UpdatedReplicas, desired)
+			reason = "RollingOut"
+		case deployment.Status.Replicas > deployment.Status.UpdatedReplicas:
+			message = fmt.Sprintf("Deployment %s rollout in progress: %d old replicas pending termination", deployment.Name, deployment.Status.Replicas-deployment.Status.UpdatedReplicas)
+			reason = "RollingOut"
+		case deployment.Status.AvailableReplicas < deployment.Status.UpdatedReplicas:
+			message = fmt.Sprintf("Deployment %s rollout in progress: %d of %d updated replicas available", deployment.Name, deployment.Status.AvailableReplicas, deployment.Status.UpdatedReplicas)
+			reason = "RollingOut"
+		default:
+			if available := getDeploymentCondition(deployment, appsv1.DeploymentAvailable); available != nil && available.Status != corev1.ConditionTrue {
+				message = fmt.Sprintf("Deployment %s is not available: %s", deployment.Name, available.Message)
+				reason = available.Reason
+			}
+		}
+
+		if reason == "" {
+			log.Printf("[INFO] Deployment %s is Healthy", deployment.Name)
+			continue
+		}
+
+		*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+			Kind:    "Deployment",
+			Name:    deployment.Name,
+			UID:     deployment.UID,
+			Status:  "Progressing",
+			Message: message,
+			Reason:  reason,
+		})
+		if *overallStatus != "failed" {
+			*overallStatus = "deploying"
+		}
+	}
+
+	return nil
+}
+
+func getDeploymentCondition(deployment appsv1.Deployment, conditionType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range deployment.Status.Conditions {
+		if deployment.Status.Conditions[i].Type == conditionType {
+			return &deployment.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// eventKinds maps the short kinds used in UnhealthyChild to the kinds recorded
+// in Event involvedObject references.
+var eventKinds = map[string]string{
+	"PV":  "PersistentVolume",
+	"PVC": "PersistentVolumeClaim",
+}
+
+// attachWarningEvents annotates each unhealthy child with the latest Warning
+// Event recorded for it within the lookback window. Events are matched by UID
+// so that a Pod recreated under the same name does not inherit the Events of
+// its predecessor. Events of cluster-scoped PVs are recorded in the default
+// namespace and looked up there.
+func attachWarningEvents(ctx context.Context, clientset *kubernetes.Clientset, namespace string, unhealthyChildren []UnhealthyChild, lookback time.Duration) error {
+	if len(unhealthyChildren) == 0 {
+		return nil
+	}
+
+	namespaces := []string{namespace}
+	for _, child := range unhealthyChildren {
+		if child.Kind == "PV" && namespace != metav1.NamespaceDefault {
+			namespaces = append(namespaces, metav1.NamespaceDefault)
+			break
+		}
+	}
+
+	latestByUID := make(map[types.UID]corev1.Event)
+	latestByName := make(map[string]corev1.Event)
+	for _, eventNamespace := range namespaces {
+		events, err := clientset.CoreV1().Events(eventNamespace).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("type", corev1.EventTypeWarning).String(),
+		})
+		if err != nil {
+			return fmt.Errorf("error listing Events in namespace %s: %v", eventNamespace, err)
+		}
+
+		for _, event := range events.Items {
+			seen := getEventTime(event)
+			if time.Since(seen) > lookback {
+				continue
+			}
+			if uid := event.InvolvedObject.UID; uid != "" {
+				if current, exists := latestByUID[uid]; !exists || seen.After(getEventTime(current)) {
+					latestByUID[uid] = event
+				}
+			}
+			key := event.InvolvedObject.Kind + "/" + event.InvolvedObject.Name
+			if current, exists := latestByName[key]; !exists || seen.After(getEventTime(current)) {
+				latestByName[key] = event
+			}
+		}
+	}
+
+	for i := range unhealthyChildren {
+		kind := unhealthyChildren[i].Kind
+		if mapped, exists := eventKinds[kind]; exists {
+			kind = mapped
+		}
+		var event corev1.Event
+		var exists bool
+		if uid := unhealthyChildren[i].UID; uid != "" {
+			event, exists = latestByUID[uid]
+		} else {
+			event, exists = latestByName[kind+"/"+unhealthyChildren[i].Name]
+		}
+		if exists {
+			log.Printf("[INFO] Warning event for %s %s: reason=%s, message=%s", kind, unhealthyChildren[i].Name, event.Reason, event.Message)
+			unhealthyChildren[i].EventReason = event.Reason
+			unhealthyChildren[i].EventMessage = event.Message
+		}
+	}
+
+	return nil
+}
+
+func getEventTime(event corev1.Event) time.Time {
+	if event.Series != nil && !event.Series.LastObservedTime.IsZero() {
+		return event.Series.LastObservedTime.Time
+	}
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.FirstTimestamp.Time
+}
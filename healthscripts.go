@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// healthScriptTimeout bounds the run time of a single health.lua script.
+var healthScriptTimeout = 5 * time.Second
+
+// healthScriptStatuses maps the health statuses of Argo CD health.lua scripts
+// onto the verdicts of a custom resource. Healthy and Unknown do not hold back
+// a "ready" verdict.
+var healthScriptStatuses = map[string]string{
+	"Healthy":     "",
+	"Unknown":     "",
+	"Progressing": "deploying",
+	"Suspended":   "deploying",
+	"Missing":     "deploying",
+	"Degraded":    "failed",
+}
+
+// unsafeOsFunctions are removed from the os library made available to
+// scripts, leaving only time and date helpers.
+var unsafeOsFunctions = []string{"execute", "exit", "getenv", "remove", "rename", "setenv", "setlocale", "tmpname"}
+
+// unsafeBaseFunctions are removed from the base library so that scripts
+// cannot load other files from the filesystem.
+var unsafeBaseFunctions = []string{"dofile", "loadfile", "module", "require"}
+
+// loadHealthScripts compiles the health.lua scripts of a directory laid out
+// like Argo CD's resource_customizations, i.e. <group>/<kind>/health.lua.
+// Scripts are keyed by "<group>/<kind>".
+func loadHealthScripts(dir string) (map[string]*lua.FunctionProto, error) {
+	scripts := make(map[string]*lua.FunctionProto)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || entry.Name() != "health.lua" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) != 3 {
+			return fmt.Errorf("health script %s is not in a <group>/<kind> directory", path)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		chunk, err := parse.Parse(file, path)
+		if err != nil {
+			return fmt.Errorf("error parsing health script %s: %v", path, err)
+		}
+		proto, err := lua.Compile(chunk, path)
+		if err != nil {
+			return fmt.Errorf("error compiling health script %s: %v", path, err)
+		}
+		scripts[parts[0]+"/"+parts[1]] = proto
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading health scripts from %s: %v", dir, err)
+	}
+	return scripts, nil
+}
+
+// evaluateHealthScript runs a health.lua script against the custom resource,
+// exposed as the global `obj`, and maps the returned {status, message} table
+// onto a verdict.
+func evaluateHealthScript(ctx context.Context, script *lua.FunctionProto, cr unstructured.Unstructured) (status, reason, message string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, healthScriptTimeout)
+	defer cancel()
+
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	L.SetContext(ctx)
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+		{lua.OsLibName, lua.OpenOs},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range unsafeBaseFunctions {
+		L.SetGlobal(name, lua.LNil)
+	}
+	if osLib, ok := L.GetGlobal(lua.OsLibName).(*lua.LTable); ok {
+		for _, name := range unsafeOsFunctions {
+			osLib.RawSetString(name, lua.LNil)
+		}
+	}
+
+	L.SetGlobal("obj", toLuaValue(L, cr.Object))
+	L.Push(L.NewFunctionFromProto(script))
+	if err := L.PCall(0, 1, nil); err != nil {
+		return "", "", "", fmt.Errorf("error running health script: %v", err)
+	}
+
+	result, ok := L.Get(-1).(*lua.LTable)
+	if !ok {
+		return "", "", "", fmt.Errorf("health script returned %s instead of a table", L.Get(-1).Type())
+	}
+	reason = lua.LVAsString(result.RawGetString("status"))
+	message = lua.LVAsString(result.RawGetString("message"))
+	status, known := healthScriptStatuses[reason]
+	if !known {
+		return "", "", "", fmt.Errorf("health script returned unknown status %q", reason)
+	}
+	if status == "" {
+		return "", "", "", nil
+	}
+	if message == "" {
+		message = fmt.Sprintf("Health script reports %s", reason)
+	}
+	return status, reason, message, nil
+}
+
+// toLuaValue converts a field of an unstructured object into a Lua value.
+// Lists become 1-indexed tables.
+func toLuaValue(L *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case int64:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case map[string]interface{}:
+		table := L.NewTable()
+		for key, item := range v {
+			table.RawSetString(key, toLuaValue(L, item))
+		}
+		return table
+	case []interface{}:
+		table := L.NewTable()
+		for _, item := range v {
+			table.Append(toLuaValue(L, item))
+		}
+		return table
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
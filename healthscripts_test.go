@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestEvaluateHealthScript(t *testing.T) {
+	const json = `{"apiVersion":"example.com/v1","kind":"Database","metadata":{"name":"db"},"spec":{"replicas":3},"status":{"readyReplicas":3,"conditions":[{"type":"Ready","status":"True"}]}}`
+
+	tests := []struct {
+		name        string
+		script      string
+		wantStatus  string
+		wantReason  string
+		wantMessage string
+		wantErr     bool
+	}{
+		{
+			name:   "healthy",
+			script: `return {status = "Healthy"}`,
+		},
+		{
+			name:   "unknown",
+			script: `return {status = "Unknown", message = "no status yet"}`,
+		},
+		{
+			name:        "progressing",
+			script:      `return {status = "Progressing", message = "Waiting for replicas"}`,
+			wantStatus:  "deploying",
+			wantReason:  "Progressing",
+			wantMessage: "Waiting for replicas",
+		},
+		{
+			name:        "suspended",
+			script:      `return {status = "Suspended"}`,
+			wantStatus:  "deploying",
+			wantReason:  "Suspended",
+			wantMessage: "Health script reports Suspended",
+		},
+		{
+			name:        "missing",
+			script:      `return {status = "Missing"}`,
+			wantStatus:  "deploying",
+			wantReason:  "Missing",
+			wantMessage: "Health script reports Missing",
+		},
+		{
+			name:        "degraded",
+			script:      `return {status = "Degraded", message = "Backup failed"}`,
+			wantStatus:  "failed",
+			wantReason:  "Degraded",
+			wantMessage: "Backup failed",
+		},
+		{
+			name: "reads the custom resource",
+			script: `if obj.status.readyReplicas == obj.spec.replicas and obj.status.conditions[1].type == "Ready" then
+  return {status = "Healthy"}
+end
+return {status = "Progressing"}`,
+		},
+		{
+			name:   "os time functions are available",
+			script: `if os.time() > 0 and os.date("%Y") ~= "" then return {status = "Healthy"} end`,
+		},
+		{
+			name:    "unknown status",
+			script:  `return {status = "Broken"}`,
+			wantErr: true,
+		},
+		{
+			name:    "no table returned",
+			script:  `return "Healthy"`,
+			wantErr: true,
+		},
+		{
+			name:    "runtime error",
+			script:  `error("boom")`,
+			wantErr: true,
+		},
+		{
+			name:    "require is unavailable",
+			script:  `require("os")`,
+			wantErr: true,
+		},
+		{
+			name:    "dofile is unavailable",
+			script:  `dofile("/etc/hostname")`,
+			wantErr: true,
+		},
+		{
+			name:    "loadfile is unavailable",
+			script:  `loadfile("/etc/hostname")`,
+			wantErr: true,
+		},
+		{
+			name:    "module is unavailable",
+			script:  `module("health")`,
+			wantErr: true,
+		},
+		{
+			name:    "package is unavailable",
+			script:  `package.loadlib("libc.so", "system")`,
+			wantErr: true,
+		},
+		{
+			name:    "io is unavailable",
+			script:  `io.open("/etc/hostname")`,
+			wantErr: true,
+		},
+		{
+			name:    "os execute is unavailable",
+			script:  `os.execute("true")`,
+			wantErr: true,
+		},
+		{
+			name:    "os getenv is unavailable",
+			script:  `os.getenv("HOME")`,
+			wantErr: true,
+		},
+		{
+			name:    "os remove is unavailable",
+			script:  `os.remove("/tmp/health")`,
+			wantErr: true,
+		},
+		{
+			name:    "endless loop times out",
+			script:  `while true do end`,
+			wantErr: true,
+		},
+	}
+
+	defer func(timeout time.Duration) { healthScriptTimeout = timeout }(healthScriptTimeout)
+	healthScriptTimeout = 100 * time.Millisecond
+
+	var cr unstructured.Unstructured
+	if err := cr.UnmarshalJSON([]byte(json)); err != nil {
+		t.Fatalf("error decoding custom resource: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk, err := parse.Parse(strings.NewReader(tt.script), tt.name)
+			if err != nil {
+				t.Fatalf("error parsing health script: %v", err)
+			}
+			script, err := lua.Compile(chunk, tt.name)
+			if err != nil {
+				t.Fatalf("error compiling health script: %v", err)
+			}
+
+			status, reason, message, err := evaluateHealthScript(context.Background(), script, cr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evaluateHealthScript() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if status != tt.wantStatus || reason != tt.wantReason || message != tt.wantMessage {
+				t.Errorf("evaluateHealthScript() = (%q, %q, %q), want (%q, %q, %q)", status, reason, message, tt.wantStatus, tt.wantReason, tt.wantMessage)
+			}
+		})
+	}
+}
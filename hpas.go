@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type HPAChecker struct {
+	// MaxReplicasDuration is how long an HPA may stay pinned at maxReplicas
+	// before it is reported as degraded.
+	MaxReplicasDuration time.Duration
+}
+
+func (hc HPAChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
+	hpas, err := listHPAs(ctx, clientset, namespace, labelSelector)
+	if err != nil {
+		return fmt.Errorf("error listing HorizontalPodAutoscalers: %v", err)
+	}
+
+	for _, hpa := range hpas {
+		if !isSelected(ctx, &hpa, annotationSelector) {
+			continue
+		}
+		log.Printf("[INFO] HPA status: name=%s, current=%d, desired=%d, max=%d", hpa.Name, hpa.Status.CurrentReplicas, hpa.Status.DesiredReplicas, hpa.Spec.MaxReplicas)
+
+		var message, reason string
+		if condition := getHPACondition(hpa, autoscalingv2.AbleToScale); condition != nil && condition.Status == corev1.ConditionFalse {
+			message = fmt.Sprintf("HPA %s is unable to scale: %s", hpa.Name, condition.Message)
+			reason = condition.Reason
+		} else if condition := getHPACondition(hpa, autoscalingv2.ScalingActive); condition != nil && condition.Status == corev1.ConditionFalse {
+			message = fmt.Sprintf("HPA %s scaling is not active: %s", hpa.Name, condition.Message)
+			reason = condition.Reason
+		} else if condition := getHPACondition(hpa, autoscalingv2.ScalingLimited); condition != nil && condition.Status == corev1.ConditionTrue &&
+			hpa.Status.CurrentReplicas >= hpa.Spec.MaxReplicas && time.Since(condition.LastTransitionTime.Time) > hc.MaxReplicasDuration {
+			message = fmt.Sprintf("HPA %s has been pinned at maxReplicas %d since %s", hpa.Name, hpa.Spec.MaxReplicas, condition.LastTransitionTime.Format(time.RFC3339))
+			reason = "PinnedAtMaxReplicas"
+		}
+
+		if reason == "" {
+			log.Printf("[INFO] HPA %s is Healthy", hpa.Name)
+			continue
+		}
+
+		// Degraded children are reported without holding back the overall status
+		*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+			Kind:    "HorizontalPodAutoscaler",
+			Name:    hpa.Name,
+			UID:     hpa.UID,
+			Status:  "Degraded",
+			Message: message,
+			Reason:  reason,
+		})
+	}
+
+	return nil
+}
+
+func getHPACondition(hpa autoscalingv2.HorizontalPodAutoscaler, conditionType autoscalingv2.HorizontalPodAutoscalerConditionType) *autoscalingv2.HorizontalPodAutoscalerCondition {
+	for i := range hpa.Status.Conditions {
+		if hpa.Status.Conditions[i].Type == conditionType {
+			return &hpa.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+)
+
+// IngressChecker checks the existence of TLS Secrets through the metadata
+// client so that their contents are never fetched. Backend Services and TLS
+// Secrets created after the Ingress, e.g. by an operator or cert-manager, are
+// awaited for ReferenceGracePeriod after the Ingress' creation.
+type IngressChecker struct {
+	Metadata             metadata.Interface
+	ReferenceGracePeriod time.Duration
+}
+
+func (ic IngressChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
+	ingresses, err := listIngresses(ctx, clientset, namespace, labelSelector)
+	if err != nil {
+		return fmt.Errorf("error listing Ingresses: %v", err)
+	}
+
+	for _, ingress := range ingresses {
+		if !isSelected(ctx, &ingress, annotationSelector) {
+			continue
+		}
+		log.Printf("[INFO] Ingress status: name=%s, loadBalancerIngress=%d", ingress.Name, len(ingress.Status.LoadBalancer.Ingress))
+
+		withinGracePeriod := time.Since(ingress.CreationTimestamp.Time) < ic.ReferenceGracePeriod
+		var missing, pending []string
+		for _, serviceName := range getIngressBackendServices(ingress) {
+			_, err := clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) && withinGracePeriod {
+				pending = append(pending, fmt.Sprintf("Service %s", serviceName))
+			} else if apierrors.IsNotFound(err) {
+				missing = append(missing, fmt.Sprintf("Service %s", serviceName))
+			} else if err != nil {
+				return fmt.Errorf("error getting Service %s of Ingress %s: %v", serviceName, ingress.Name, err)
+			}
+		}
+		for _, secretName := range getIngressTLSSecrets(ingress) {
+			_, err := ic.Metadata.Resource(corev1.SchemeGroupVersion.WithResource("secrets")).Namespace(namespace).Get(ctx, secretName, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) && withinGracePeriod {
+				pending = append(pending, fmt.Sprintf("Secret %s", secretName))
+			} else if apierrors.IsNotFound(err) {
+				missing = append(missing, fmt.Sprintf("Secret %s", secretName))
+			} else if err != nil {
+				return fmt.Errorf("error getting Secret %s of Ingress %s: %v", secretName, ingress.Name, err)
+			}
+		}
+
+		if len(missing) > 0 {
+			log.Printf("[INFO] Ingress %s references missing objects: %s", ingress.Name, strings.Join(missing, ", "))
+			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+				Kind:    "Ingress",
+				Name:    ingress.Name,
+				UID:     ingress.UID,
+				Status:  "Failed",
+				Message: fmt.Sprintf("Ingress %s references missing objects: %s", ingress.Name, strings.Join(missing, ", ")),
+				Reason:  "MissingReference",
+			})
+			*overallStatus = "failed"
+			continue
+		}
+
+		if len(pending) > 0 {
+			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+				Kind:    "Ingress",
+				Name:    ingress.Name,
+				UID:     ingress.UID,
+				Status:  "Pending",
+				Message: fmt.Sprintf("Ingress %s is waiting for referenced objects: %s", ingress.Name, strings.Join(pending, ", ")),
+				Reason:  "ReferencePending",
+			})
+			if *overallStatus != "failed" {
+				*overallStatus = "deploying"
+			}
+			continue
+		}
+
+		if !hasIngressLoadBalancerAddress(ingress) {
+			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+				Kind:    "Ingress",
+				Name:    ingress.Name,
+				UID:     ingress.UID,
+				Status:  "Pending",
+				Message: fmt.Sprintf("Ingress %s is waiting for a load balancer address", ingress.Name),
+				Reason:  "LoadBalancerPending",
+			})
+			if *overallStatus != "failed" {
+				*overallStatus = "deploying"
+			}
+			continue
+		}
+
+		log.Printf("[INFO] Ingress %s is Healthy", ingress.Name)
+	}
+
+	return nil
+}
+
+func getIngressBackendServices(ingress networkingv1.Ingress) []string {
+	names := make(map[string]struct{})
+	if backend := ingress.Spec.DefaultBackend; backend != nil && backend.Service != nil {
+		names[backend.Service.Name] = struct{}{}
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.Service != nil {
+				names[path.Backend.Service.Name] = struct{}{}
+			}
+		}
+	}
+	return sortedKeys(names)
+}
+
+func getIngressTLSSecrets(ingress networkingv1.Ingress) []string {
+	names := make(map[string]struct{})
+	for _, tls := range ingress.Spec.TLS {
+		// An empty secret name falls back to the controller's default certificate
+		if tls.SecretName != "" {
+			names[tls.SecretName] = struct{}{}
+		}
+	}
+	return sortedKeys(names)
+}
+
+func hasIngressLoadBalancerAddress(ingress networkingv1.Ingress) bool {
+	for _, entry := range ingress.Status.LoadBalancer.Ingress {
+		if entry.IP != "" || entry.Hostname != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -4,55 +4,119 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+// defaultJobBackoffLimit is the backoffLimit applied by the API server when
+// spec.backoffLimit is unset.
+const defaultJobBackoffLimit = 6
+
 type JobChecker struct{}
 
 func (jc JobChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
-	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
-	jobFailureThreshold := 3
+	jobs, err := listJobs(ctx, clientset, namespace, labelSelector)
 	if err != nil {
 		return fmt.Errorf("error listing Jobs: %v", err)
 	}
 
-	for _, job := range jobs.Items {
-		if !matchAnnotations(job.Annotations, annotationSelector) {
+	for _, job := range jobs {
+		if !isSelected(ctx, &job, annotationSelector) {
+			continue
+		}
+		// Jobs spawned by a CronJob are evaluated by CronJobChecker
+		if isOwnedByCronJob(job) {
+			continue
+		}
+		log.Printf("[INFO] Job status: name=%s, succeeded=%d, failed=%d, active=%d", job.Name, job.Status.Succeeded, job.Status.Failed, job.Status.Active)
+
+		if isJobConditionTrue(job, batchv1.JobComplete) {
+			log.Printf("[INFO] Job %s is Complete", job.Name)
 			continue
 		}
-		log.Printf("[INFO] Job status: name=%s, succeeded=%d, failed=%d", job.Name, job.Status.Succeeded, job.Status.Failed)
 
-		if job.Status.Failed >= int32(jobFailureThreshold) {
-			log.Printf("[INFO] Job status: name=%s, succeeded=%d, failed=%d", job.Name, job.Status.Succeeded, job.Status.Failed)
+		backoffLimit := int32(defaultJobBackoffLimit)
+		if job.Spec.BackoffLimit != nil {
+			backoffLimit = *job.Spec.BackoffLimit
+		}
+
+		var failureMessage, failureReason string
+		switch {
+		case isJobConditionTrue(job, batchv1.JobFailed):
+			failureMessage = fmt.Sprintf("Job %s has failed after %d failed pods", job.Name, job.Status.Failed)
+			failureReason = getJobFailureReason(job)
+		case job.Status.Failed > backoffLimit:
+			failureMessage = fmt.Sprintf("Job %s has %d failed pods, exceeding its backoffLimit of %d", job.Name, job.Status.Failed, backoffLimit)
+			failureReason = "BackoffLimitExceeded"
+		case job.Spec.ActiveDeadlineSeconds != nil && job.Status.StartTime != nil &&
+			time.Since(job.Status.StartTime.Time) > time.Duration(*job.Spec.ActiveDeadlineSeconds)*time.Second:
+			failureMessage = fmt.Sprintf("Job %s has been active longer than its activeDeadlineSeconds of %d", job.Name, *job.Spec.ActiveDeadlineSeconds)
+			failureReason = "DeadlineExceeded"
+		}
+		if failureReason != "" {
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "Job",
 				Name:    job.Name,
+				UID:     job.UID,
 				Status:  "Failed",
-				Message: fmt.Sprintf("Job %s has failed %d times", job.Name, job.Status.Failed),
-				Reason:  getJobFailureReason(job),
+				Message: failureMessage,
+				Reason:  failureReason,
 			})
 			*overallStatus = "failed"
-		} else if job.Status.Succeeded == 0 {
-			log.Printf("[INFO] Job status: name=%s, succeeded=%d, failed=%d", job.Name, job.Status.Succeeded, job.Status.Failed)
+			continue
+		}
+
+		if job.Spec.Suspend != nil && *job.Spec.Suspend {
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "Job",
 				Name:    job.Name,
-				Status:  "Pending",
-				Message: fmt.Sprintf("Job %s is in Pending state", job.Name),
-				Reason:  getJobFailureReason(job),
+				UID:     job.UID,
+				Status:  "Suspended",
+				Message: fmt.Sprintf("Job %s is suspended at %s", job.Name, getJobProgress(job)),
+				Reason:  "Suspended",
 			})
 			if *overallStatus != "failed" {
 				*overallStatus = "deploying"
 			}
+			continue
+		}
+
+		parallelism := int32(1)
+		if job.Spec.Parallelism != nil {
+			parallelism = *job.Spec.Parallelism
+		}
+		*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+			Kind:    "Job",
+			Name:    job.Name,
+			UID:     job.UID,
+			Status:  "Running",
+			Message: fmt.Sprintf("Job %s is in progress: %s, %d/%d pods active, %d failed of backoffLimit %d", job.Name, getJobProgress(job), job.Status.Active, parallelism, job.Status.Failed, backoffLimit),
+			Reason:  "InProgress",
+		})
+		if *overallStatus != "failed" {
+			*overallStatus = "deploying"
 		}
 	}
 
 	return nil
 }
 
+// getJobProgress describes how far the Job is towards completion, such as
+// "7/10 completions". Work queue Jobs without spec.completions only report
+// their successful pods.
+func getJobProgress(job batchv1.Job) string {
+	if job.Spec.Completions == nil {
+		return fmt.Sprintf("%d succeeded", job.Status.Succeeded)
+	}
+	progress := fmt.Sprintf("%d/%d completions", job.Status.Succeeded, *job.Spec.Completions)
+	if job.Spec.CompletionMode != nil && *job.Spec.CompletionMode == batchv1.IndexedCompletion && job.Status.CompletedIndexes != "" {
+		progress = fmt.Sprintf("%s (completed indexes %s)", progress, job.Status.CompletedIndexes)
+	}
+	return progress
+}
+
 func getJobFailureReason(job batchv1.Job) string {
 	for _, condition := range job.Status.Conditions {
 		if condition.Type == batchv1.JobFailed {
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+type namespaceObjectsKey struct{}
+
+// namespaceObjects holds the objects of a namespace that make up the owner
+// graph of the custom resource. They are listed once per check to build the
+// graph and then shared with the checkers, which filter them by label
+// selector locally instead of listing them again.
+type namespaceObjects struct {
+	Deployments  []appsv1.Deployment
+	ReplicaSets  []appsv1.ReplicaSet
+	StatefulSets []appsv1.StatefulSet
+	DaemonSets   []appsv1.DaemonSet
+	CronJobs     []batchv1.CronJob
+	Jobs         []batchv1.Job
+	Pods         []corev1.Pod
+	Services     []corev1.Service
+	Ingresses    []networkingv1.Ingress
+	PVCs         []corev1.PersistentVolumeClaim
+	HPAs         []autoscalingv2.HorizontalPodAutoscaler
+
+	// listed holds the kinds above that were listed. The others are listed
+	// from the API server by the checkers that need them.
+	listed map[string]struct{}
+}
+
+// leafKinds maps the kinds of the owner graph that own no other objects to
+// the child kinds whose checkers read them. They are only listed when one of
+// those child kinds is evaluated, so that a kind a policy leaves out, or whose
+// API the cluster does not serve, cannot fail the check.
+var leafKinds = map[string][]string{
+	"Service":                 {"Service"},
+	"Ingress":                 {"Ingress"},
+	"PVC":                     {"PV", "PVC", "VolumeAttachment"},
+	"HorizontalPodAutoscaler": {"HorizontalPodAutoscaler"},
+}
+
+// listNamespaceObjects lists the workloads of the namespace, which link the
+// custom resource to its Pods, and the leaf kinds needed by the evaluated
+// child kinds. A nil kinds evaluates every kind.
+func listNamespaceObjects(ctx context.Context, clientset *kubernetes.Clientset, namespace string, kinds map[string]struct{}) (*namespaceObjects, error) {
+	objects := &namespaceObjects{listed: make(map[string]struct{})}
+	var err error
+
+	if objects.Deployments, err = listDeployments(ctx, clientset, namespace, ""); err != nil {
+		return nil, fmt.Errorf("error listing Deployments: %v", err)
+	}
+	if objects.ReplicaSets, err = listReplicaSets(ctx, clientset, namespace, ""); err != nil {
+		return nil, fmt.Errorf("error listing ReplicaSets: %v", err)
+	}
+	if objects.StatefulSets, err = listStatefulSets(ctx, clientset, namespace, ""); err != nil {
+		return nil, fmt.Errorf("error listing StatefulSets: %v", err)
+	}
+	if objects.DaemonSets, err = listDaemonSets(ctx, clientset, namespace, ""); err != nil {
+		return nil, fmt.Errorf("error listing DaemonSets: %v", err)
+	}
+	if objects.CronJobs, err = listCronJobs(ctx, clientset, namespace, ""); err != nil {
+		return nil, fmt.Errorf("error listing CronJobs: %v", err)
+	}
+	if objects.Jobs, err = listJobs(ctx, clientset, namespace, ""); err != nil {
+		return nil, fmt.Errorf("error listing Jobs: %v", err)
+	}
+	if objects.Pods, err = listPods(ctx, clientset, namespace, ""); err != nil {
+		return nil, fmt.Errorf("error listing Pods: %v", err)
+	}
+	for _, kind := range []string{"Deployment", "ReplicaSet", "StatefulSet", "DaemonSet", "CronJob", "Job", "Pod"} {
+		objects.listed[kind] = struct{}{}
+	}
+
+	needed := func(kind string) bool {
+		if kinds == nil {
+			return true
+		}
+		for _, childKind := range leafKinds[kind] {
+			if _, exists := kinds[childKind]; exists {
+				return true
+			}
+		}
+		return false
+	}
+	if needed("Service") {
+		if objects.Services, err = listServices(ctx, clientset, namespace, ""); err != nil {
+			return nil, fmt.Errorf("error listing Services: %v", err)
+		}
+		objects.listed["Service"] = struct{}{}
+	}
+	if needed("Ingress") {
+		if objects.Ingresses, err = listIngresses(ctx, clientset, namespace, ""); err != nil {
+			return nil, fmt.Errorf("error listing Ingresses: %v", err)
+		}
+		objects.listed["Ingress"] = struct{}{}
+	}
+	if needed("PVC") {
+		if objects.PVCs, err = listPVCs(ctx, clientset, namespace, ""); err != nil {
+			return nil, fmt.Errorf("error listing PVCs: %v", err)
+		}
+		objects.listed["PVC"] = struct{}{}
+	}
+	if needed("HorizontalPodAutoscaler") {
+		if objects.HPAs, err = listHPAs(ctx, clientset, namespace, ""); err != nil {
+			return nil, fmt.Errorf("error listing HorizontalPodAutoscalers: %v", err)
+		}
+		objects.listed["HorizontalPodAutoscaler"] = struct{}{}
+	}
+
+	return objects, nil
+}
+
+// withNamespaceObjects stores the objects listed for the owner graph in the
+// context so that listObjects can reuse them.
+func withNamespaceObjects(ctx context.Context, objects *namespaceObjects) context.Context {
+	return context.WithValue(ctx, namespaceObjectsKey{}, objects)
+}
+
+func getNamespaceObjects(ctx context.Context) *namespaceObjects {
+	objects, _ := ctx.Value(namespaceObjectsKey{}).(*namespaceObjects)
+	return objects
+}
+
+// listObjects returns the objects of the namespace matching the label
+// selector, from the objects in the context when they include the kind and
+// from the API server otherwise. Errors are returned as is for the caller to
+// wrap.
+func listObjects[T any, PT interface {
+	*T
+	metav1.Object
+}, L runtime.Object](ctx context.Context, kind, labelSelector string, list func(context.Context, metav1.ListOptions) (L, error), cached func(*namespaceObjects) []T) ([]T, error) {
+	if objects := getNamespaceObjects(ctx); objects != nil {
+		if _, listed := objects.listed[kind]; listed {
+			selector, err := labels.Parse(labelSelector)
+			if err != nil {
+				return nil, err
+			}
+			var items []T
+			for _, item := range cached(objects) {
+				if selector.Matches(labels.Set(PT(&item).GetLabels())) {
+					items = append(items, item)
+				}
+			}
+			return items, nil
+		}
+	}
+
+	result, err := list(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+	listed, err := meta.ExtractList(result)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]T, 0, len(listed))
+	for _, obj := range listed {
+		items = append(items, *obj.(PT))
+	}
+	return items, nil
+}
+
+func listPods(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector string) ([]corev1.Pod, error) {
+	return listObjects(ctx, "Pod", labelSelector, clientset.CoreV1().Pods(namespace).List, func(objects *namespaceObjects) []corev1.Pod { return objects.Pods })
+}
+
+func listReplicaSets(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector string) ([]appsv1.ReplicaSet, error) {
+	return listObjects(ctx, "ReplicaSet", labelSelector, clientset.AppsV1().ReplicaSets(namespace).List, func(objects *namespaceObjects) []appsv1.ReplicaSet { return objects.ReplicaSets })
+}
+
+func listDeployments(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector string) ([]appsv1.Deployment, error) {
+	return listObjects(ctx, "Deployment", labelSelector, clientset.AppsV1().Deployments(namespace).List, func(objects *namespaceObjects) []appsv1.Deployment { return objects.Deployments })
+}
+
+func listStatefulSets(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector string) ([]appsv1.StatefulSet, error) {
+	return listObjects(ctx, "StatefulSet", labelSelector, clientset.AppsV1().StatefulSets(namespace).List, func(objects *namespaceObjects) []appsv1.StatefulSet { return objects.StatefulSets })
+}
+
+func listDaemonSets(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector string) ([]appsv1.DaemonSet, error) {
+	return listObjects(ctx, "DaemonSet", labelSelector, clientset.AppsV1().DaemonSets(namespace).List, func(objects *namespaceObjects) []appsv1.DaemonSet { return objects.DaemonSets })
+}
+
+func listCronJobs(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector string) ([]batchv1.CronJob, error) {
+	return listObjects(ctx, "CronJob", labelSelector, clientset.BatchV1().CronJobs(namespace).List, func(objects *namespaceObjects) []batchv1.CronJob { return objects.CronJobs })
+}
+
+func listJobs(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector string) ([]batchv1.Job, error) {
+	return listObjects(ctx, "Job", labelSelector, clientset.BatchV1().Jobs(namespace).List, func(objects *namespaceObjects) []batchv1.Job { return objects.Jobs })
+}
+
+func listServices(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector string) ([]corev1.Service, error) {
+	return listObjects(ctx, "Service", labelSelector, clientset.CoreV1().Services(namespace).List, func(objects *namespaceObjects) []corev1.Service { return objects.Services })
+}
+
+func listIngresses(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector string) ([]networkingv1.Ingress, error) {
+	return listObjects(ctx, "Ingress", labelSelector, clientset.NetworkingV1().Ingresses(namespace).List, func(objects *namespaceObjects) []networkingv1.Ingress { return objects.Ingresses })
+}
+
+func listPVCs(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector string) ([]corev1.PersistentVolumeClaim, error) {
+	return listObjects(ctx, "PVC", labelSelector, clientset.CoreV1().PersistentVolumeClaims(namespace).List, func(objects *namespaceObjects) []corev1.PersistentVolumeClaim { return objects.PVCs })
+}
+
+func listHPAs(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector string) ([]autoscalingv2.HorizontalPodAutoscaler, error) {
+	return listObjects(ctx, "HorizontalPodAutoscaler", labelSelector, clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).List, func(objects *namespaceObjects) []autoscalingv2.HorizontalPodAutoscaler { return objects.HPAs })
+}
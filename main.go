@@ -14,14 +14,18 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	lua "github.com/yuin/gopher-lua"
 	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 )
 
 type CustomResourceStatus struct {
 	Status  string           `json:"status"`
 	Details []UnhealthyChild `json:"details,omitempty"`
+	Reason  string           `json:"reason,omitempty"`
 	Message string           `json:"message,omitempty"`
 }
 
@@ -33,17 +37,34 @@ type ResourceStatus struct {
 }
 
 var (
-	statusCache           = make(map[string]ResourceStatus)
-	statusCacheMu         sync.Mutex
-	rateLimiter           *rate.Limiter
-	checkInterval         = 25 * time.Second
-	consecHealthy         = 4
-	consecFailed          = 3
-	limiterRate           = 10
-	limiterBurst          = 20
-	increaseIntervalValue = 15 * time.Second
-	readyCheckInterval    = 60 * time.Second
-	initialDelay          = 10 * time.Second // Default initial delay
+	statusCache            = make(map[string]ResourceStatus)
+	statusCacheMu          sync.Mutex
+	rateLimiter            *rate.Limiter
+	checkInterval          = 25 * time.Second
+	consecHealthy          = 4
+	consecFailed           = 3
+	limiterRate            = 10
+	limiterBurst           = 20
+	increaseIntervalValue  = 15 * time.Second
+	readyCheckInterval     = 60 * time.Second
+	initialDelay           = 10 * time.Second // Default initial delay
+	cronJobMissedSchedules = 3
+	cronJobAllowSuspended  = false
+	hpaMaxReplicasDuration = 30 * time.Minute
+	eventLookback          = 1 * time.Hour
+	podRestartThreshold    = 5
+	imagePullGracePeriod   = 5 * time.Minute
+	podTerminationMargin   = 2 * time.Minute
+	podEvictionPolicy      = "ignore"
+	podEvictionMaxAge      = 24 * time.Hour
+	pvcResizeTimeout       = 30 * time.Minute
+	pvcProvisioningTimeout = 5 * time.Minute
+	volumeAttachTimeout    = 5 * time.Minute
+	ownerDiscovery         = true
+	healthPolicies         = make(map[string]HealthPolicy)
+	healthScripts          = make(map[string]*lua.FunctionProto)
+	ingressGracePeriod     = 10 * time.Minute
+	metadataClient         metadata.Interface
 )
 
 func init() {
@@ -94,6 +115,93 @@ func init() {
 			initialDelay = parsedValue
 		}
 	}
+
+	if value, exists := os.LookupEnv("CRONJOB_MISSED_SCHEDULES"); exists {
+		if parsedValue, err := strconv.Atoi(value); err == nil {
+			cronJobMissedSchedules = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("CRONJOB_ALLOW_SUSPENDED"); exists {
+		if parsedValue, err := strconv.ParseBool(value); err == nil {
+			cronJobAllowSuspended = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("HPA_MAX_REPLICAS_DURATION"); exists {
+		if parsedValue, err := time.ParseDuration(value); err == nil {
+			hpaMaxReplicasDuration = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("INGRESS_GRACE_PERIOD"); exists {
+		if parsedValue, err := time.ParseDuration(value); err == nil {
+			ingressGracePeriod = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("EVENT_LOOKBACK"); exists {
+		if parsedValue, err := time.ParseDuration(value); err == nil {
+			eventLookback = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("POD_RESTART_THRESHOLD"); exists {
+		if parsedValue, err := strconv.Atoi(value); err == nil {
+			podRestartThreshold = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("IMAGE_PULL_GRACE_PERIOD"); exists {
+		if parsedValue, err := time.ParseDuration(value); err == nil {
+			imagePullGracePeriod = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("POD_TERMINATION_MARGIN"); exists {
+		if parsedValue, err := time.ParseDuration(value); err == nil {
+			podTerminationMargin = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("POD_EVICTION_POLICY"); exists {
+		switch value {
+		case "ignore", "warn", "fail":
+			podEvictionPolicy = value
+		default:
+			log.Printf("[ERROR] Invalid POD_EVICTION_POLICY %q, using %q", value, podEvictionPolicy)
+		}
+	}
+
+	if value, exists := os.LookupEnv("POD_EVICTION_MAX_AGE"); exists {
+		if parsedValue, err := time.ParseDuration(value); err == nil {
+			podEvictionMaxAge = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("PVC_RESIZE_TIMEOUT"); exists {
+		if parsedValue, err := time.ParseDuration(value); err == nil {
+			pvcResizeTimeout = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("PVC_PROVISIONING_TIMEOUT"); exists {
+		if parsedValue, err := time.ParseDuration(value); err == nil {
+			pvcProvisioningTimeout = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("VOLUME_ATTACH_TIMEOUT"); exists {
+		if parsedValue, err := time.ParseDuration(value); err == nil {
+			volumeAttachTimeout = parsedValue
+		}
+	}
+
+	if value, exists := os.LookupEnv("OWNER_DISCOVERY"); exists {
+		if parsedValue, err := strconv.ParseBool(value); err == nil {
+			ownerDiscovery = parsedValue
+		}
+	}
 }
 
 func main() {
@@ -109,6 +217,27 @@ func main() {
 		log.Fatalf("[ERROR] Failed to create clientset: %v", err)
 	}
 
+	metadataClient, err = metadata.NewForConfig(config)
+	if err != nil {
+		log.Fatalf("[ERROR] Failed to create metadata client: %v", err)
+	}
+
+	if path, exists := os.LookupEnv("HEALTH_POLICY_FILE"); exists {
+		healthPolicies, err = loadHealthPolicies(path)
+		if err != nil {
+			log.Fatalf("[ERROR] Failed to load health policies: %v", err)
+		}
+		log.Printf("[INFO] Loaded %d health policies from %s", len(healthPolicies), path)
+	}
+
+	if dir, exists := os.LookupEnv("HEALTH_SCRIPTS_DIR"); exists {
+		healthScripts, err = loadHealthScripts(dir)
+		if err != nil {
+			log.Fatalf("[ERROR] Failed to load health scripts: %v", err)
+		}
+		log.Printf("[INFO] Loaded %d health scripts from %s", len(healthScripts), dir)
+	}
+
 	rateLimiter = rate.NewLimiter(rate.Limit(limiterRate), limiterBurst)
 
 	r := mux.NewRouter()
@@ -242,10 +371,6 @@ func monitorHealth(clientset *kubernetes.Clientset, key, crdGroup, crdVersion, c
 				consecutiveHealthyChecks = 0
 			}
 
-			if newStatus.Status == "failed" {
-				consecFailed = 0
-			}
-
 			if consecutiveHealthyChecks >= consecHealthy {
 				log.Printf("[INFO] Resource %s has been ready for %d consecutive checks. Stopping further checks.", key, consecHealthy)
 				return
@@ -273,37 +398,48 @@ func checkHealth(clientset *kubernetes.Clientset, crdGroup, crdVersion, crdPlura
 		return CustomResourceStatus{}, fmt.Errorf("[ERROR] Failed to get custom resource: %v", err)
 	}
 
-	var crMap map[string]interface{}
-	if err := json.Unmarshal(customResource, &crMap); err != nil {
+	// The unstructured JSON scheme decodes integers as int64, which the
+	// unstructured accessors expect, rather than encoding/json's float64
+	var cr unstructured.Unstructured
+	if err := cr.UnmarshalJSON(customResource); err != nil {
 		return CustomResourceStatus{}, fmt.Errorf("[ERROR] Failed to unmarshal custom resource: %v", err)
 	}
 
-	prettyJSON, err := json.MarshalIndent(crMap, "", "  ")
+	prettyJSON, err := json.MarshalIndent(cr.Object, "", "  ")
 	if err != nil {
 		return CustomResourceStatus{}, fmt.Errorf("[ERROR] Failed to marshal pretty JSON: %v", err)
 	}
 
 	log.Printf("[INFO] Custom resource fetched: %s", string(prettyJSON))
 
-	var crStatus map[string]interface{}
-	log.Printf("[INFO] Unmarshaling custom resource status")
-	err = json.Unmarshal(customResource, &crStatus)
-	if err != nil {
-		return CustomResourceStatus{}, fmt.Errorf("[ERROR] Failed to unmarshal custom resource: %v", err)
+	var policy *HealthPolicy
+	if p, exists := healthPolicies[fmt.Sprintf("%s/%s/%s", crdGroup, crdVersion, crdPlural)]; exists {
+		log.Printf("[INFO] Using health policy for %s/%s/%s", crdGroup, crdVersion, crdPlural)
+		policy = &p
 	}
 
-	log.Printf("[INFO] Custom resource status: %+v", crStatus)
+	if ownerDiscovery {
+		objects, err := listNamespaceObjects(ctx, clientset, namespace, evaluatedKinds(policy))
+		if err != nil {
+			return CustomResourceStatus{}, fmt.Errorf("[ERROR] Failed to discover children of custom resource: %v", err)
+		}
+		// The checkers filter these lists instead of listing the namespace again
+		ctx = withNamespaceObjects(ctx, objects)
+		descendants := buildDescendants(objects, namespace, cr.GetUID())
+		if len(descendants) > 0 {
+			ctx = withDescendants(ctx, descendants)
+		} else {
+			// Children that are only labelled would otherwise all be skipped and
+			// the custom resource reported ready without any evaluation
+			log.Printf("[INFO] Custom resource %s owns no objects in namespace %s, falling back to labelSelector %q", name, namespace, labelSelector)
+		}
+	}
 
 	var unhealthyChildren []UnhealthyChild
 	overallStatus := "ready"
 	isCompleteCheck := true
 
-	checkers := []ResourceChecker{
-		PodChecker{},
-		JobChecker{},
-		PVChecker{},
-		PVCChecker{},
-	}
+	checkers, optionalCheckers := buildCheckers(policy)
 
 	for _, checker := range checkers {
 		log.Printf("[INFO] Running checker: %T for resource: %s/%s in namespace %s of kind %s/%s", checker, name, crdPlural, namespace, crdGroup, crdVersion)
@@ -315,9 +451,42 @@ func checkHealth(clientset *kubernetes.Clientset, crdGroup, crdVersion, crdPlura
 		}
 	}
 
-	// Ensure status is only "ready" or "failed" after all checks
+	// Optional children are reported without affecting the overall status
+	for _, checker := range optionalCheckers {
+		log.Printf("[INFO] Running optional checker: %T for resource: %s/%s in namespace %s of kind %s/%s", checker, name, crdPlural, namespace, crdGroup, crdVersion)
+		var optionalChildren []UnhealthyChild
+		optionalStatus := "ready"
+		err = checker.Check(ctx, clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector, &optionalChildren, &optionalStatus)
+		if err != nil {
+			log.Printf("[ERROR] Error checking resource with optional checker %T for resource: %s/%s in namespace %s of kind %s/%s: %v", checker, name, crdPlural, namespace, crdGroup, crdVersion, err)
+			continue
+		}
+		for i := range optionalChildren {
+			optionalChildren[i].Optional = true
+		}
+		unhealthyChildren = append(unhealthyChildren, optionalChildren...)
+	}
+
+	// Rules run last so they can see which children were reported unhealthy
+	if policy != nil && len(policy.Rules) > 0 {
+		checker := RuleChecker{CustomResource: cr, Rules: policy.Rules, Kinds: evaluatedKinds(policy)}
+		log.Printf("[INFO] Running checker: %T for resource: %s/%s in namespace %s of kind %s/%s", checker, name, crdPlural, namespace, crdGroup, crdVersion)
+		err = checker.Check(ctx, clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector, &unhealthyChildren, &overallStatus)
+		if err != nil {
+			log.Printf("[ERROR] Error checking resource with checker %T for resource: %s/%s in namespace %s of kind %s/%s: %v", checker, name, crdPlural, namespace, crdGroup, crdVersion, err)
+			return CustomResourceStatus{}, err
+		}
+	}
+
+	if err := attachWarningEvents(ctx, clientset, namespace, unhealthyChildren, eventLookback); err != nil {
+		log.Printf("[ERROR] Error correlating events for resource: %s/%s in namespace %s of kind %s/%s: %v", name, crdPlural, namespace, crdGroup, crdVersion, err)
+	}
+
+	// Ensure status is only "ready", "deploying" or "failed" after all checks
 	if isCompleteCheck {
-		if len(unhealthyChildren) > 0 {
+		if overallStatus == "failed" {
+			overallStatus = "failed"
+		} else if countBlockingChildren(unhealthyChildren) > 0 {
 			overallStatus = "deploying"
 		} else if overallStatus == "ready" {
 			overallStatus = "ready"
@@ -328,9 +497,30 @@ func checkHealth(clientset *kubernetes.Clientset, crdGroup, crdVersion, crdPlura
 		overallStatus = "deploying"
 	}
 
+	// The operator's own view of the custom resource can only make the verdict worse
+	var crVerdict, crReason, crMessage string
+	script, hasScript := healthScripts[fmt.Sprintf("%s/%s", crdGroup, cr.GetKind())]
+	if policy != nil && policy.Status != nil {
+		crVerdict, crReason, crMessage = evaluateStatusPolicy(*policy.Status, cr)
+	} else if hasScript {
+		crVerdict, crReason, crMessage, err = evaluateHealthScript(ctx, script, cr)
+		if err != nil {
+			log.Printf("[ERROR] Health script for %s/%s failed: %v", crdGroup, cr.GetKind(), err)
+			crVerdict, crReason, crMessage = "deploying", "HealthScriptError", err.Error()
+		}
+	} else {
+		crVerdict, crReason, crMessage = evaluateCustomResource(cr)
+	}
+	if crVerdict != "" {
+		log.Printf("[INFO] Custom resource reports %s: %s", crVerdict, crMessage)
+		if crVerdict == "failed" || overallStatus == "ready" {
+			overallStatus = crVerdict
+		}
+	}
+
 	log.Printf("[INFO] Resource status: %s for resource: %s/%s in namespace %s of kind %s/%s", overallStatus, name, crdPlural, namespace, crdGroup, crdVersion)
 
-	return CustomResourceStatus{Status: overallStatus, Details: unhealthyChildren}, nil
+	return CustomResourceStatus{Status: overallStatus, Details: unhealthyChildren, Reason: crReason, Message: crMessage}, nil
 }
 
 func matchAnnotations(resourceAnnotations map[string]string, annotationSelector string) bool {
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type descendantsKey struct{}
+
+// withDescendants stores the UIDs of the custom resource's descendants in the
+// context so that checkers only evaluate objects that belong to it.
+func withDescendants(ctx context.Context, descendants map[types.UID]struct{}) context.Context {
+	return context.WithValue(ctx, descendantsKey{}, descendants)
+}
+
+// isSelected reports whether a child listed by a checker belongs to the custom
+// resource. Without an owner graph in the context every listed object that
+// matches the annotation selector is selected.
+func isSelected(ctx context.Context, obj metav1.Object, annotationSelector string) bool {
+	if !matchAnnotations(obj.GetAnnotations(), annotationSelector) {
+		return false
+	}
+	descendants, ok := ctx.Value(descendantsKey{}).(map[types.UID]struct{})
+	if !ok {
+		return true
+	}
+	_, exists := descendants[obj.GetUID()]
+	return exists
+}
+
+// buildDescendants follows ownerReferences down from the custom resource
+// (CR → Deployment → ReplicaSet → Pod and so on) and returns the UIDs of all
+// objects in the namespace it transitively owns. PVCs created from
+// volumeClaimTemplates carry no ownerReference, so PVCs mounted by descendant
+// Pods are included as well.
+func buildDescendants(namespaceObjects *namespaceObjects, namespace string, rootUID types.UID) map[types.UID]struct{} {
+	var objects []metav1.Object
+	add := func(obj metav1.Object) { objects = append(objects, obj) }
+	for i := range namespaceObjects.Deployments {
+		add(&namespaceObjects.Deployments[i])
+	}
+	for i := range namespaceObjects.ReplicaSets {
+		add(&namespaceObjects.ReplicaSets[i])
+	}
+	for i := range namespaceObjects.StatefulSets {
+		add(&namespaceObjects.StatefulSets[i])
+	}
+	for i := range namespaceObjects.DaemonSets {
+		add(&namespaceObjects.DaemonSets[i])
+	}
+	for i := range namespaceObjects.CronJobs {
+		add(&namespaceObjects.CronJobs[i])
+	}
+	for i := range namespaceObjects.Jobs {
+		add(&namespaceObjects.Jobs[i])
+	}
+	for i := range namespaceObjects.Pods {
+		add(&namespaceObjects.Pods[i])
+	}
+	for i := range namespaceObjects.Services {
+		add(&namespaceObjects.Services[i])
+	}
+	for i := range namespaceObjects.Ingresses {
+		add(&namespaceObjects.Ingresses[i])
+	}
+	for i := range namespaceObjects.PVCs {
+		add(&namespaceObjects.PVCs[i])
+	}
+	for i := range namespaceObjects.HPAs {
+		add(&namespaceObjects.HPAs[i])
+	}
+
+	children := make(map[types.UID][]types.UID)
+	for _, obj := range objects {
+		for _, owner := range obj.GetOwnerReferences() {
+			children[owner.UID] = append(children[owner.UID], obj.GetUID())
+		}
+	}
+
+	descendants := make(map[types.UID]struct{})
+	queue := []types.UID{rootUID}
+	for len(queue) > 0 {
+		uid := queue[0]
+		queue = queue[1:]
+		for _, child := range children[uid] {
+			if _, seen := descendants[child]; seen {
+				continue
+			}
+			descendants[child] = struct{}{}
+			queue = append(queue, child)
+		}
+	}
+
+	pvcUIDs := make(map[string]types.UID)
+	for _, pvc := range namespaceObjects.PVCs {
+		pvcUIDs[pvc.Name] = pvc.UID
+	}
+	for _, pod := range namespaceObjects.Pods {
+		if _, owned := descendants[pod.UID]; !owned {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+			if uid, exists := pvcUIDs[volume.PersistentVolumeClaim.ClaimName]; exists {
+				descendants[uid] = struct{}{}
+			}
+		}
+	}
+
+	log.Printf("[INFO] Found %d descendants of %s in namespace %s", len(descendants), rootUID, namespace)
+	return descendants
+}
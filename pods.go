@@ -4,34 +4,138 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"regexp"
+	"strings"
+	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
-type PodChecker struct{}
+type PodChecker struct {
+	// RestartThreshold is the restart count at which a crash looping
+	// container escalates its Pod to failed.
+	RestartThreshold int32
+	// ImagePullGracePeriod is how long a Pod may keep failing to pull an
+	// image before it escalates to failed.
+	ImagePullGracePeriod time.Duration
+	// TerminationMargin is how long a deleted Pod may outlive its grace
+	// period before it is reported as stuck terminating.
+	TerminationMargin time.Duration
+	// EvictionPolicy decides how evicted, preempted and shut down Pods of a
+	// controller are reported: "ignore", "warn" or "fail".
+	EvictionPolicy string
+	// EvictionMaxAge is how long after their removal such Pods are still
+	// reported.
+	EvictionMaxAge time.Duration
+}
+
+// evictionReasons are the Pod status reasons of Pods that failed because they
+// were removed from their node rather than because their containers failed.
+var evictionReasons = map[string]struct{}{
+	"Evicted":    {},
+	"Preempting": {},
+	"Shutdown":   {},
+}
+
+// imagePullFailureReasons are the container waiting reasons reported by the
+// kubelet when an image cannot be pulled.
+var imagePullFailureReasons = map[string]struct{}{
+	"ErrImagePull":     {},
+	"ImagePullBackOff": {},
+	"InvalidImageName": {},
+}
 
 func (pc PodChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
-	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	pods, err := listPods(ctx, clientset, namespace, labelSelector)
 	if err != nil {
 		return fmt.Errorf("error listing Pods: %v", err)
 	}
 
-	for _, pod := range pods.Items {
-		if !matchAnnotations(pod.Annotations, annotationSelector) {
+	readyByController := make(map[string]int)
+	for _, pod := range pods {
+		if key := getPodControllerKey(pod); key != "" && pod.DeletionTimestamp == nil && pod.Status.Phase == corev1.PodRunning && isPodHealthy(pod) {
+			readyByController[key]++
+		}
+	}
+
+	firstChild := len(*unhealthyChildren)
+	podsByName := make(map[string]corev1.Pod)
+	// causes records the container behind each Pod's verdict so that its own
+	// termination is reported rather than another container's
+	causes := make(map[string]string)
+	for _, pod := range pods {
+		if !isSelected(ctx, &pod, annotationSelector) {
 			continue
 		}
+		podsByName[pod.Name] = pod
 		log.Printf("[INFO] Pod status: name=%s, phase=%s", pod.Name, pod.Status.Phase)
 
+		if pod.DeletionTimestamp != nil {
+			// The API server sets deletionTimestamp to the deletion request time
+			// plus the grace period, so only the margin is added here
+			if time.Since(pod.DeletionTimestamp.Time) <= pc.TerminationMargin {
+				log.Printf("[INFO] Pod %s is terminating", pod.Name)
+				continue
+			}
+			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+				Kind:    "Pod",
+				Name:    pod.Name,
+				UID:     pod.UID,
+				Status:  "Terminating",
+				Message: fmt.Sprintf("Pod %s has been terminating since %s, past its grace period", pod.Name, pod.DeletionTimestamp.Format(time.RFC3339)),
+				Reason:  "StuckTerminating",
+			})
+			if *overallStatus != "failed" {
+				*overallStatus = "deploying"
+			}
+			continue
+		}
+
+		if cs := getImagePullFailure(pod); cs != nil {
+			causes[pod.Name] = cs.Name
+			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+				Kind:    "Pod",
+				Name:    pod.Name,
+				UID:     pod.UID,
+				Status:  string(pod.Status.Phase),
+				Message: fmt.Sprintf("Pod %s container %s cannot pull image %s: %s", pod.Name, cs.Name, cs.Image, cs.State.Waiting.Message),
+				Reason:  cs.State.Waiting.Reason,
+			})
+			if time.Since(getImagePullFailureStart(pod, *cs)) > pc.ImagePullGracePeriod {
+				*overallStatus = "failed"
+			} else if *overallStatus != "failed" {
+				*overallStatus = "deploying"
+			}
+			continue
+		}
+
 		switch pod.Status.Phase {
 		case corev1.PodRunning:
 			if isPodHealthy(pod) {
 				continue
+			} else if cs := getCrashLoopingContainer(pod); cs != nil {
+				causes[pod.Name] = cs.Name
+				*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+					Kind:    "Pod",
+					Name:    pod.Name,
+					UID:     pod.UID,
+					Status:  string(pod.Status.Phase),
+					Message: fmt.Sprintf("Pod %s container %s is in CrashLoopBackOff after %d restarts", pod.Name, cs.Name, cs.RestartCount),
+					Reason:  "CrashLoopBackOff",
+				})
+				if pc.RestartThreshold > 0 && cs.RestartCount >= pc.RestartThreshold {
+					*overallStatus = "failed"
+				} else if *overallStatus != "failed" {
+					*overallStatus = "deploying"
+				}
 			} else {
 				*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 					Kind:    "Pod",
 					Name:    pod.Name,
+					UID:     pod.UID,
 					Status:  string(pod.Status.Phase),
 					Message: fmt.Sprintf("Pod %s is in %s state but not all containers are ready", pod.Name, pod.Status.Phase),
 					Reason:  "NotAllContainersReady",
@@ -41,9 +145,42 @@ func (pc PodChecker) Check(ctx context.Context, clientset *kubernetes.Clientset,
 				}
 			}
 		case corev1.PodPending:
+			if cs, reason := getBlockingInitContainer(pod); cs != nil {
+				causes[pod.Name] = cs.Name
+				*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+					Kind:    "Pod",
+					Name:    pod.Name,
+					UID:     pod.UID,
+					Status:  string(pod.Status.Phase),
+					Message: fmt.Sprintf("Pod %s is blocked on init container %s: %s", pod.Name, cs.Name, reason),
+					Reason:  "Init:" + reason,
+				})
+				if pc.RestartThreshold > 0 && cs.RestartCount >= pc.RestartThreshold && isCrashLooping(*cs) {
+					*overallStatus = "failed"
+				} else if *overallStatus != "failed" {
+					*overallStatus = "deploying"
+				}
+				continue
+			}
+			if condition := getPodCondition(pod, corev1.PodScheduled); condition != nil && condition.Status == corev1.ConditionFalse {
+				*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+					Kind:             "Pod",
+					Name:             pod.Name,
+					UID:              pod.UID,
+					Status:           string(pod.Status.Phase),
+					Message:          fmt.Sprintf("Pod %s cannot be scheduled: %s", pod.Name, condition.Message),
+					Reason:           condition.Reason,
+					SchedulingCauses: classifySchedulingFailure(condition.Message),
+				})
+				if *overallStatus != "failed" {
+					*overallStatus = "deploying"
+				}
+				continue
+			}
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "Pod",
 				Name:    pod.Name,
+				UID:     pod.UID,
 				Status:  string(pod.Status.Phase),
 				Message: fmt.Sprintf("Pod %s is in Pending state", pod.Name),
 				Reason:  "Pending",
@@ -52,9 +189,28 @@ func (pc PodChecker) Check(ctx context.Context, clientset *kubernetes.Clientset,
 				*overallStatus = "deploying"
 			}
 		case corev1.PodFailed, corev1.PodUnknown:
+			if _, evicted := evictionReasons[pod.Status.Reason]; evicted && pod.Status.Phase == corev1.PodFailed {
+				if owner := metav1.GetControllerOf(&pod); owner != nil && pc.EvictionPolicy != "fail" {
+					if time.Since(getPodRemovalTime(pod)) > pc.EvictionMaxAge ||
+						(pc.EvictionPolicy == "ignore" && readyByController[getPodControllerKey(pod)] > 0) {
+						log.Printf("[INFO] Ignoring %s Pod %s of %s %s", pod.Status.Reason, pod.Name, owner.Kind, owner.Name)
+						continue
+					}
+					*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+						Kind:    "Pod",
+						Name:    pod.Name,
+						UID:     pod.UID,
+						Status:  "Degraded",
+						Message: fmt.Sprintf("Pod %s of %s %s was removed from its node: %s", pod.Name, owner.Kind, owner.Name, pod.Status.Message),
+						Reason:  pod.Status.Reason,
+					})
+					continue
+				}
+			}
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "Pod",
 				Name:    pod.Name,
+				UID:     pod.UID,
 				Status:  string(pod.Status.Phase),
 				Message: fmt.Sprintf("Pod %s is in %s state", pod.Name, pod.Status.Phase),
 				Reason:  getPodFailureReason(pod),
@@ -66,6 +222,7 @@ func (pc PodChecker) Check(ctx context.Context, clientset *kubernetes.Clientset,
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "Pod",
 				Name:    pod.Name,
+				UID:     pod.UID,
 				Status:  string(pod.Status.Phase),
 				Message: fmt.Sprintf("Pod %s is in an unexpected state: %s", pod.Name, pod.Status.Phase),
 				Reason:  "Unknown",
@@ -76,9 +233,53 @@ func (pc PodChecker) Check(ctx context.Context, clientset *kubernetes.Clientset,
 		}
 	}
 
+	for i := firstChild; i < len(*unhealthyChildren); i++ {
+		child := &(*unhealthyChildren)[i]
+		if termination := getContainerTermination(podsByName[child.Name], causes[child.Name]); termination != nil {
+			child.Termination = termination
+			child.Message = fmt.Sprintf("%s (container %s last terminated: %s)", child.Message, termination.Container, termination.summary())
+		}
+	}
+
 	return nil
 }
 
+// getPodControllerKey identifies the workload a Pod belongs to. Pods of a
+// Deployment are keyed by the Deployment rather than their ReplicaSet so that
+// replacements created by a newer ReplicaSet are counted together. Returns an
+// empty string for Pods without a controller.
+func getPodControllerKey(pod corev1.Pod) string {
+	owner := metav1.GetControllerOf(&pod)
+	if owner == nil {
+		return ""
+	}
+	if hash, exists := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; exists && owner.Kind == "ReplicaSet" && strings.HasSuffix(owner.Name, "-"+hash) {
+		return "Deployment/" + strings.TrimSuffix(owner.Name, "-"+hash)
+	}
+	return owner.Kind + "/" + owner.Name
+}
+
+// getPodRemovalTime returns when the Pod was removed from its node: the last
+// transition of its DisruptionTarget condition, else the latest termination of
+// its containers, else its creation.
+func getPodRemovalTime(pod corev1.Pod) time.Time {
+	if condition := getPodCondition(pod, corev1.DisruptionTarget); condition != nil && condition.Status == corev1.ConditionTrue && !condition.LastTransitionTime.IsZero() {
+		return condition.LastTransitionTime.Time
+	}
+	var removed time.Time
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, containerStatus := range statuses {
+			if terminated := containerStatus.State.Terminated; terminated != nil && terminated.FinishedAt.After(removed) {
+				removed = terminated.FinishedAt.Time
+			}
+		}
+	}
+	if removed.IsZero() {
+		return pod.CreationTimestamp.Time
+	}
+	return removed
+}
+
 func isPodHealthy(pod corev1.Pod) bool {
 	for _, condition := range pod.Status.Conditions {
 		if condition.Type == corev1.PodReady && condition.Status != corev1.ConditionTrue {
@@ -90,10 +291,83 @@ func isPodHealthy(pod corev1.Pod) bool {
 			return false
 		}
 	}
+	sidecars := getSidecarContainerNames(pod)
+	for _, containerStatus := range pod.Status.InitContainerStatuses {
+		if isSidecar(sidecars, containerStatus.Name) && !containerStatus.Ready {
+			return false
+		}
+	}
 	return true
 }
 
+// getSidecarContainerNames returns the native sidecars of the Pod, i.e. the
+// init containers with restartPolicy Always that keep running next to the
+// regular containers.
+func getSidecarContainerNames(pod corev1.Pod) map[string]struct{} {
+	sidecars := make(map[string]struct{})
+	for _, container := range pod.Spec.InitContainers {
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			sidecars[container.Name] = struct{}{}
+		}
+	}
+	return sidecars
+}
+
+// getBlockingInitContainer returns the first init container, in spec order,
+// that keeps the Pod from starting its regular containers together with the
+// reason it is blocking.
+func getBlockingInitContainer(pod corev1.Pod) (*corev1.ContainerStatus, string) {
+	sidecars := getSidecarContainerNames(pod)
+	statuses := make(map[string]*corev1.ContainerStatus)
+	for i := range pod.Status.InitContainerStatuses {
+		statuses[pod.Status.InitContainerStatuses[i].Name] = &pod.Status.InitContainerStatuses[i]
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		containerStatus, exists := statuses[container.Name]
+		if !exists {
+			return nil, ""
+		}
+		state := containerStatus.State
+		switch {
+		case state.Waiting != nil:
+			reason := state.Waiting.Reason
+			if reason == "" {
+				reason = "Waiting"
+			}
+			return containerStatus, reason
+		case state.Terminated != nil:
+			// Sidecars only terminate once the Pod itself is shutting down
+			if state.Terminated.ExitCode == 0 || isSidecar(sidecars, container.Name) {
+				continue
+			}
+			reason := state.Terminated.Reason
+			if reason == "" {
+				reason = "Error"
+			}
+			return containerStatus, reason
+		case state.Running != nil:
+			// A sidecar unblocks the next init container once it has started
+			if isSidecar(sidecars, container.Name) && containerStatus.Started != nil && *containerStatus.Started {
+				continue
+			}
+			return containerStatus, "Running"
+		default:
+			return containerStatus, "Waiting"
+		}
+	}
+	return nil, ""
+}
+
+func isSidecar(sidecars map[string]struct{}, name string) bool {
+	_, exists := sidecars[name]
+	return exists
+}
+
 func getPodFailureReason(pod corev1.Pod) string {
+	if cs, reason := getBlockingInitContainer(pod); cs != nil {
+		return "Init:" + reason
+	}
 	if len(pod.Status.ContainerStatuses) > 0 {
 		for _, containerStatus := range pod.Status.ContainerStatuses {
 			if containerStatus.State.Waiting != nil {
@@ -103,3 +377,217 @@ func getPodFailureReason(pod corev1.Pod) string {
 	}
 	return "Unknown"
 }
+
+// crashLoopWindow is how long after its last termination a container is
+// still considered crash looping. The kubelet caps the restart back-off at
+// 5m and resets it once a container has run for 10m.
+const crashLoopWindow = 10 * time.Minute
+
+// getCrashLoopingContainer returns the crash looping container with the most
+// restarts, or nil if none is crash looping. Native sidecars are long-running
+// and are considered alongside regular containers.
+func getCrashLoopingContainer(pod corev1.Pod) *corev1.ContainerStatus {
+	sidecars := getSidecarContainerNames(pod)
+	candidates := make([]*corev1.ContainerStatus, 0, len(pod.Status.ContainerStatuses)+len(sidecars))
+	for i := range pod.Status.ContainerStatuses {
+		candidates = append(candidates, &pod.Status.ContainerStatuses[i])
+	}
+	for i := range pod.Status.InitContainerStatuses {
+		if isSidecar(sidecars, pod.Status.InitContainerStatuses[i].Name) {
+			candidates = append(candidates, &pod.Status.InitContainerStatuses[i])
+		}
+	}
+
+	var crashLooping *corev1.ContainerStatus
+	for _, containerStatus := range candidates {
+		if !isCrashLooping(*containerStatus) {
+			continue
+		}
+		if crashLooping == nil || containerStatus.RestartCount > crashLooping.RestartCount {
+			crashLooping = containerStatus
+		}
+	}
+	return crashLooping
+}
+
+// isCrashLooping reports whether a container is waiting in CrashLoopBackOff
+// or terminated within crashLoopWindow. Between back-offs a crash looping
+// container is terminated or briefly running, so its last termination is
+// considered as well. The lifetime restart count alone does not make a
+// container crash looping, as it is never reset.
+func isCrashLooping(containerStatus corev1.ContainerStatus) bool {
+	if containerStatus.State.Waiting != nil && containerStatus.State.Waiting.Reason == "CrashLoopBackOff" {
+		return true
+	}
+	for _, terminated := range []*corev1.ContainerStateTerminated{containerStatus.State.Terminated, containerStatus.LastTerminationState.Terminated} {
+		if terminated != nil && time.Since(terminated.FinishedAt.Time) < crashLoopWindow {
+			return true
+		}
+	}
+	return false
+}
+
+// getImagePullFailure returns the first init or regular container that is
+// waiting on an image it cannot pull, or nil if all images were pulled.
+func getImagePullFailure(pod corev1.Pod) *corev1.ContainerStatus {
+	statuses := [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses}
+	for _, list := range statuses {
+		for i := range list {
+			if list[i].State.Waiting == nil {
+				continue
+			}
+			if _, isPullFailure := imagePullFailureReasons[list[i].State.Waiting.Reason]; isPullFailure {
+				return &list[i]
+			}
+		}
+	}
+	return nil
+}
+
+// getImagePullFailureStart estimates when the container started failing to
+// pull its image: the later of the Pod's creation, the last transition of its
+// ContainersReady condition and the end of the container's previous run, so
+// that a long-running Pod restarting into a registry outage gets the full
+// grace period.
+func getImagePullFailureStart(pod corev1.Pod, containerStatus corev1.ContainerStatus) time.Time {
+	start := pod.CreationTimestamp.Time
+	if condition := getPodCondition(pod, corev1.ContainersReady); condition != nil && condition.Status != corev1.ConditionTrue && condition.LastTransitionTime.After(start) {
+		start = condition.LastTransitionTime.Time
+	}
+	if terminated := containerStatus.LastTerminationState.Terminated; terminated != nil && terminated.FinishedAt.After(start) {
+		start = terminated.FinishedAt.Time
+	}
+	return start
+}
+
+// ContainerTermination describes the most relevant abnormal termination of a
+// container in an unhealthy Pod.
+type ContainerTermination struct {
+	Container   string      `json:"container"`
+	Reason      string      `json:"reason,omitempty"`
+	ExitCode    int32       `json:"exitCode"`
+	Signal      int32       `json:"signal,omitempty"`
+	FinishedAt  metav1.Time `json:"finishedAt,omitempty"`
+	MemoryLimit string      `json:"memoryLimit,omitempty"`
+}
+
+func (t ContainerTermination) summary() string {
+	summary := t.Reason
+	if summary == "" {
+		summary = "Error"
+	}
+	if t.Reason == "OOMKilled" && t.MemoryLimit != "" {
+		summary = fmt.Sprintf("%s at %s limit", summary, t.MemoryLimit)
+	}
+	summary = fmt.Sprintf("%s, exit code %d", summary, t.ExitCode)
+	if t.Signal != 0 {
+		summary = fmt.Sprintf("%s, signal %d", summary, t.Signal)
+	}
+	return summary
+}
+
+// getContainerTermination looks through the current and last states of the
+// given container, or of all containers when it is empty, for an OOM kill,
+// non-zero exit code or signal. Init containers that have since completed
+// successfully are skipped.
+func getContainerTermination(pod corev1.Pod, container string) *ContainerTermination {
+	memoryLimits := make(map[string]string)
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			if limit, exists := container.Resources.Limits[corev1.ResourceMemory]; exists {
+				memoryLimits[container.Name] = limit.String()
+			}
+		}
+	}
+
+	for i, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		isInit := i == 0
+		for _, containerStatus := range statuses {
+			if container != "" && containerStatus.Name != container {
+				continue
+			}
+			if isInit && containerStatus.State.Terminated != nil && containerStatus.State.Terminated.ExitCode == 0 {
+				continue
+			}
+			for _, terminated := range []*corev1.ContainerStateTerminated{containerStatus.State.Terminated, containerStatus.LastTerminationState.Terminated} {
+				if terminated == nil || (terminated.Reason != "OOMKilled" && terminated.ExitCode == 0 && terminated.Signal == 0) {
+					continue
+				}
+				return &ContainerTermination{
+					Container:   containerStatus.Name,
+					Reason:      terminated.Reason,
+					ExitCode:    terminated.ExitCode,
+					Signal:      terminated.Signal,
+					FinishedAt:  terminated.FinishedAt,
+					MemoryLimit: memoryLimits[containerStatus.Name],
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// schedulingFailurePatterns map fragments of the scheduler's FailedScheduling
+// message to a cause. Matching is done on the lowercased message.
+var schedulingFailurePatterns = []struct {
+	fragment string
+	cause    string
+}{
+	{"too many pods", "InsufficientPods"},
+	{"untolerated taint", "Taints"},
+	{"had taint", "Taints"},
+	{"didn't match pod's node affinity/selector", "NodeAffinity"},
+	{"didn't match pod affinity rules", "PodAffinity"},
+	{"didn't match pod anti-affinity rules", "PodAntiAffinity"},
+	{"didn't satisfy existing pods anti-affinity rules", "PodAntiAffinity"},
+	{"didn't match pod topology spread constraints", "TopologySpread"},
+	{"unbound immediate persistentvolumeclaims", "UnboundPVC"},
+	{"volume node affinity conflict", "VolumeNodeAffinity"},
+	{"didn't have free ports", "HostPorts"},
+}
+
+var insufficientResourcePattern = regexp.MustCompile(`insufficient ([a-z0-9./-]+)`)
+
+// classifySchedulingFailure returns the distinct causes found in the message
+// of a PodScheduled=False condition, or "Unknown" if none is recognised.
+func classifySchedulingFailure(message string) []string {
+	lowered := strings.ToLower(message)
+	var causes []string
+	seen := make(map[string]struct{})
+	addCause := func(cause string) {
+		if _, exists := seen[cause]; !exists {
+			seen[cause] = struct{}{}
+			causes = append(causes, cause)
+		}
+	}
+
+	for _, match := range insufficientResourcePattern.FindAllStringSubmatch(lowered, -1) {
+		switch match[1] {
+		case "cpu":
+			addCause("InsufficientCPU")
+		case "memory":
+			addCause("InsufficientMemory")
+		default:
+			addCause("InsufficientResources")
+		}
+	}
+	for _, pattern := range schedulingFailurePatterns {
+		if strings.Contains(lowered, pattern.fragment) {
+			addCause(pattern.cause)
+		}
+	}
+
+	if len(causes) == 0 {
+		return []string{"Unknown"}
+	}
+	return causes
+}
+
+func getPodCondition(pod corev1.Pod, conditionType corev1.PodConditionType) *corev1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == conditionType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
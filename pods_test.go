@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetCrashLoopingContainer(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	recent := metav1.NewTime(time.Now().Add(-time.Minute))
+	stale := metav1.NewTime(time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name           string
+		initContainers []corev1.Container
+		initStatuses   []corev1.ContainerStatus
+		statuses       []corev1.ContainerStatus
+		want           string
+	}{
+		{
+			name: "waiting in CrashLoopBackOff",
+			statuses: []corev1.ContainerStatus{
+				{Name: "app", RestartCount: 1, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+			},
+			want: "app",
+		},
+		{
+			name: "terminated recently",
+			statuses: []corev1.ContainerStatus{
+				{Name: "app", RestartCount: 3, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, FinishedAt: recent}}},
+			},
+			want: "app",
+		},
+		{
+			name: "terminated long ago",
+			statuses: []corev1.ContainerStatus{
+				{Name: "app", RestartCount: 3, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, FinishedAt: stale}}},
+			},
+		},
+		{
+			name: "running after a recent termination",
+			statuses: []corev1.ContainerStatus{
+				{Name: "app", RestartCount: 6, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}, LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, FinishedAt: recent}}},
+			},
+			want: "app",
+		},
+		{
+			name: "running unready with many past restarts",
+			statuses: []corev1.ContainerStatus{
+				{Name: "app", RestartCount: 50, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}, LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, FinishedAt: stale}}},
+			},
+		},
+		{
+			name: "waiting for another reason",
+			statuses: []corev1.ContainerStatus{
+				{Name: "app", RestartCount: 10, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+			},
+		},
+		{
+			name: "most restarts wins",
+			statuses: []corev1.ContainerStatus{
+				{Name: "app", RestartCount: 2, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+				{Name: "proxy", RestartCount: 7, LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, FinishedAt: recent}}},
+			},
+			want: "proxy",
+		},
+		{
+			name:           "native sidecar in CrashLoopBackOff",
+			initContainers: []corev1.Container{{Name: "sidecar", RestartPolicy: &always}},
+			initStatuses: []corev1.ContainerStatus{
+				{Name: "sidecar", RestartCount: 4, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+			},
+			statuses: []corev1.ContainerStatus{
+				{Name: "app", Ready: true, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+			want: "sidecar",
+		},
+		{
+			name:           "init container is not considered",
+			initContainers: []corev1.Container{{Name: "init"}},
+			initStatuses: []corev1.ContainerStatus{
+				{Name: "init", RestartCount: 4, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := corev1.Pod{
+				Spec: corev1.PodSpec{InitContainers: tt.initContainers},
+				Status: corev1.PodStatus{
+					InitContainerStatuses: tt.initStatuses,
+					ContainerStatuses:     tt.statuses,
+				},
+			}
+			var got string
+			if cs := getCrashLoopingContainer(pod); cs != nil {
+				got = cs.Name
+			}
+			if got != tt.want {
+				t.Errorf("getCrashLoopingContainer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
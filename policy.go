@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// HealthPolicyFile is the YAML or JSON document loaded from HEALTH_POLICY_FILE.
+// Policies are keyed by "<crdGroup>/<crdVersion>/<crdPlural>".
+type HealthPolicyFile struct {
+	Policies map[string]HealthPolicy `json:"policies"`
+}
+
+// HealthPolicy customises how the custom resources of one CRD are evaluated.
+type HealthPolicy struct {
+	// Children lists the child kinds to evaluate. All kinds are evaluated
+	// when empty.
+	Children []string `json:"children,omitempty"`
+	// OptionalChildren lists child kinds that are reported but never hold
+	// back or fail the overall status.
+	OptionalChildren []string `json:"optionalChildren,omitempty"`
+	// Status declares which values of the custom resource's own status mean
+	// ready, failed or progressing. It replaces the built-in evaluation of
+	// status.conditions and status.phase when set.
+	Status *StatusPolicy `json:"status,omitempty"`
+	// Rules are CEL expressions that must all hold for the custom resource to
+	// be ready.
+	Rules []HealthRule `json:"rules,omitempty"`
+	// Thresholds override the values configured through the environment.
+	Thresholds Thresholds `json:"thresholds,omitempty"`
+}
+
+type StatusPolicy struct {
+	Ready       []StatusMatcher `json:"ready,omitempty"`
+	Failed      []StatusMatcher `json:"failed,omitempty"`
+	Progressing []StatusMatcher `json:"progressing,omitempty"`
+}
+
+// StatusMatcher matches either a dotted field path of the custom resource,
+// such as "status.phase", or the status of a condition in status.conditions
+// against a list of values.
+type StatusMatcher struct {
+	Field     string   `json:"field,omitempty"`
+	Condition string   `json:"condition,omitempty"`
+	Values    []string `json:"values"`
+}
+
+type Thresholds struct {
+	PodRestartThreshold    *int32           `json:"podRestartThreshold,omitempty"`
+	ImagePullGracePeriod   *metav1.Duration `json:"imagePullGracePeriod,omitempty"`
+	PodTerminationMargin   *metav1.Duration `json:"podTerminationMargin,omitempty"`
+	PodEvictionPolicy      *string          `json:"podEvictionPolicy,omitempty"`
+	PodEvictionMaxAge      *metav1.Duration `json:"podEvictionMaxAge,omitempty"`
+	CronJobMissedSchedules *int             `json:"cronJobMissedSchedules,omitempty"`
+	CronJobAllowSuspended  *bool            `json:"cronJobAllowSuspended,omitempty"`
+	HPAMaxReplicasDuration *metav1.Duration `json:"hpaMaxReplicasDuration,omitempty"`
+	PVCResizeTimeout       *metav1.Duration `json:"pvcResizeTimeout,omitempty"`
+	PVCProvisioningTimeout *metav1.Duration `json:"pvcProvisioningTimeout,omitempty"`
+	VolumeAttachTimeout    *metav1.Duration `json:"volumeAttachTimeout,omitempty"`
+	IngressGracePeriod     *metav1.Duration `json:"ingressGracePeriod,omitempty"`
+}
+
+// checkerKinds is the order in which checkers run, keyed by the child kind
+// they report.
+var checkerKinds = []string{
+	"Pod",
+	"Deployment",
+	"StatefulSet",
+	"DaemonSet",
+	"Service",
+	"Ingress",
+	"Job",
+	"CronJob",
+	"PV",
+	"PVC",
+	"VolumeAttachment",
+	"HorizontalPodAutoscaler",
+}
+
+func loadHealthPolicies(path string) (map[string]HealthPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading health policy file %s: %v", path, err)
+	}
+	var file HealthPolicyFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing health policy file %s: %v", path, err)
+	}
+
+	known := make(map[string]struct{})
+	for _, kind := range checkerKinds {
+		known[kind] = struct{}{}
+	}
+	for key, policy := range file.Policies {
+		if len(strings.Split(key, "/")) != 3 {
+			return nil, fmt.Errorf("invalid health policy key %q, expected <group>/<version>/<plural>", key)
+		}
+		for _, kind := range append(append([]string{}, policy.Children...), policy.OptionalChildren...) {
+			if _, exists := known[kind]; !exists {
+				return nil, fmt.Errorf("health policy %s references unknown child kind %q", key, kind)
+			}
+		}
+		if value := policy.Thresholds.PodEvictionPolicy; value != nil && *value != "ignore" && *value != "warn" && *value != "fail" {
+			return nil, fmt.Errorf("health policy %s has invalid podEvictionPolicy %q", key, *value)
+		}
+		if policy.Status != nil {
+			matchers := append(append(append([]StatusMatcher{}, policy.Status.Ready...), policy.Status.Failed...), policy.Status.Progressing...)
+			for _, matcher := range matchers {
+				if (matcher.Field == "") == (matcher.Condition == "") {
+					return nil, fmt.Errorf("health policy %s has a status matcher that must set exactly one of field and condition", key)
+				}
+			}
+		}
+		for i := range policy.Rules {
+			if err := compileHealthRule(&policy.Rules[i]); err != nil {
+				return nil, fmt.Errorf("health policy %s: %v", key, err)
+			}
+		}
+	}
+	return file.Policies, nil
+}
+
+// buildCheckers returns the checkers for the required and optional child kinds
+// of the policy, configured from the environment and the policy thresholds.
+// A nil policy evaluates every kind with the environment configuration.
+func buildCheckers(policy *HealthPolicy) (required, optional []ResourceChecker) {
+	podChecker := PodChecker{RestartThreshold: int32(podRestartThreshold), ImagePullGracePeriod: imagePullGracePeriod, TerminationMargin: podTerminationMargin, EvictionPolicy: podEvictionPolicy, EvictionMaxAge: podEvictionMaxAge}
+	cronJobChecker := CronJobChecker{MissedSchedules: cronJobMissedSchedules, AllowSuspended: cronJobAllowSuspended}
+	hpaChecker := HPAChecker{MaxReplicasDuration: hpaMaxReplicasDuration}
+	pvcChecker := PVCChecker{ResizeTimeout: pvcResizeTimeout, ProvisioningTimeout: pvcProvisioningTimeout, EventLookback: eventLookback}
+	volumeAttachmentChecker := VolumeAttachmentChecker{AttachTimeout: volumeAttachTimeout}
+	ingressChecker := IngressChecker{Metadata: metadataClient, ReferenceGracePeriod: ingressGracePeriod}
+
+	requiredKinds := make(map[string]struct{})
+	optionalKinds := make(map[string]struct{})
+	if policy != nil {
+		t := policy.Thresholds
+		if t.PodRestartThreshold != nil {
+			podChecker.RestartThreshold = *t.PodRestartThreshold
+		}
+		if t.ImagePullGracePeriod != nil {
+			podChecker.ImagePullGracePeriod = t.ImagePullGracePeriod.Duration
+		}
+		if t.PodTerminationMargin != nil {
+			podChecker.TerminationMargin = t.PodTerminationMargin.Duration
+		}
+		if t.PodEvictionPolicy != nil {
+			podChecker.EvictionPolicy = *t.PodEvictionPolicy
+		}
+		if t.PodEvictionMaxAge != nil {
+			podChecker.EvictionMaxAge = t.PodEvictionMaxAge.Duration
+		}
+		if t.CronJobMissedSchedules != nil {
+			cronJobChecker.MissedSchedules = *t.CronJobMissedSchedules
+		}
+		if t.CronJobAllowSuspended != nil {
+			cronJobChecker.AllowSuspended = *t.CronJobAllowSuspended
+		}
+		if t.HPAMaxReplicasDuration != nil {
+			hpaChecker.MaxReplicasDuration = t.HPAMaxReplicasDuration.Duration
+		}
+		if t.PVCResizeTimeout != nil {
+			pvcChecker.ResizeTimeout = t.PVCResizeTimeout.Duration
+		}
+		if t.PVCProvisioningTimeout != nil {
+			pvcChecker.ProvisioningTimeout = t.PVCProvisioningTimeout.Duration
+		}
+		if t.VolumeAttachTimeout != nil {
+			volumeAttachmentChecker.AttachTimeout = t.VolumeAttachTimeout.Duration
+		}
+		if t.IngressGracePeriod != nil {
+			ingressChecker.ReferenceGracePeriod = t.IngressGracePeriod.Duration
+		}
+
+		for _, kind := range policy.Children {
+			requiredKinds[kind] = struct{}{}
+		}
+		for _, kind := range policy.OptionalChildren {
+			optionalKinds[kind] = struct{}{}
+		}
+	}
+
+	checkersByKind := map[string]ResourceChecker{
+		"Pod":                     podChecker,
+		"Deployment":              DeploymentChecker{},
+		"StatefulSet":             StatefulSetChecker{},
+		"DaemonSet":               DaemonSetChecker{},
+		"Service":                 ServiceChecker{},
+		"Ingress":                 ingressChecker,
+		"Job":                     JobChecker{},
+		"CronJob":                 cronJobChecker,
+		"PV":                      PVChecker{},
+		"PVC":                     pvcChecker,
+		"VolumeAttachment":        volumeAttachmentChecker,
+		"HorizontalPodAutoscaler": hpaChecker,
+	}
+	for _, kind := range checkerKinds {
+		if _, isOptional := optionalKinds[kind]; isOptional {
+			optional = append(optional, checkersByKind[kind])
+			continue
+		}
+		if _, isRequired := requiredKinds[kind]; len(requiredKinds) == 0 || isRequired {
+			required = append(required, checkersByKind[kind])
+		}
+	}
+	return required, optional
+}
+
+// evaluatedKinds returns the required and optional child kinds of the policy,
+// or nil when every kind is evaluated.
+func evaluatedKinds(policy *HealthPolicy) map[string]struct{} {
+	if policy == nil || len(policy.Children) == 0 {
+		return nil
+	}
+	kinds := make(map[string]struct{})
+	for _, kind := range append(append([]string{}, policy.Children...), policy.OptionalChildren...) {
+		kinds[kind] = struct{}{}
+	}
+	return kinds
+}
+
+// evaluateStatusPolicy applies the policy's status matchers to the custom
+// resource. Failed matchers take precedence over progressing ones, and a
+// custom resource that matches none of the ready matchers is still deploying.
+func evaluateStatusPolicy(statusPolicy StatusPolicy, cr unstructured.Unstructured) (status, reason, message string) {
+	if matcher, value, reason, matched := matchStatus(statusPolicy.Failed, cr); matched {
+		return "failed", reason, fmt.Sprintf("Custom resource %s is %s", matcher.describe(), value)
+	}
+	if matcher, value, reason, matched := matchStatus(statusPolicy.Progressing, cr); matched {
+		return "deploying", reason, fmt.Sprintf("Custom resource %s is %s", matcher.describe(), value)
+	}
+	if len(statusPolicy.Ready) > 0 {
+		if _, _, _, matched := matchStatus(statusPolicy.Ready, cr); !matched {
+			return "deploying", "NotReady", "Custom resource does not match any ready status of its health policy"
+		}
+	}
+	return "", "", ""
+}
+
+// matchStatus returns the first matcher whose value is found in the custom
+// resource, together with that value and the reason to report: the reason of
+// a matched condition, or the value itself when there is none.
+func matchStatus(matchers []StatusMatcher, cr unstructured.Unstructured) (StatusMatcher, string, string, bool) {
+	conditions := getCustomResourceConditions(cr)
+	for _, matcher := range matchers {
+		var value, reason string
+		var found bool
+		if matcher.Condition != "" {
+			var condition crCondition
+			condition, found = conditions[matcher.Condition]
+			value = condition.Status
+			reason = condition.Reason
+		} else {
+			var field interface{}
+			field, found, _ = unstructured.NestedFieldNoCopy(cr.Object, strings.Split(matcher.Field, ".")...)
+			if found {
+				value = fmt.Sprint(field)
+			}
+		}
+		if !found {
+			continue
+		}
+		if reason == "" {
+			reason = value
+		}
+		for _, expected := range matcher.Values {
+			if value == expected {
+				return matcher, value, reason, true
+			}
+		}
+	}
+	return StatusMatcher{}, "", "", false
+}
+
+func (m StatusMatcher) describe() string {
+	if m.Condition != "" {
+		return fmt.Sprintf("condition %s", m.Condition)
+	}
+	return m.Field
+}
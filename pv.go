@@ -6,6 +6,7 @@ import (
 	"log"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
@@ -13,13 +14,25 @@ import (
 type PVChecker struct{}
 
 func (pvChecker PVChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
-	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	pvcs, err := listPVCs(ctx, clientset, namespace, labelSelector)
 	if err != nil {
-		return fmt.Errorf("error listing PVs: %v", err)
+		return fmt.Errorf("error listing PVCs: %v", err)
 	}
 
-	for _, pv := range pvs.Items {
-		if !matchAnnotations(pv.Annotations, annotationSelector) {
+	// PVs are cluster scoped, so they are resolved through the selected PVCs
+	// instead of the label selector to keep other namespaces' volumes out
+	for _, pvc := range pvcs {
+		if !isSelected(ctx, &pvc, annotationSelector) || pvc.Spec.VolumeName == "" {
+			continue
+		}
+		pv, err := clientset.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			log.Printf("[INFO] PV %s of PVC %s does not exist", pvc.Spec.VolumeName, pvc.Name)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error getting PV %s of PVC %s: %v", pvc.Spec.VolumeName, pvc.Name, err)
+		}
+		if !isClaimedBy(*pv, pvc) {
 			continue
 		}
 		log.Printf("[INFO] PV status: name=%s, phase=%s", pv.Name, pv.Status.Phase)
@@ -33,18 +46,20 @@ func (pvChecker PVChecker) Check(ctx context.Context, clientset *kubernetes.Clie
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "PV",
 				Name:    pv.Name,
+				UID:     pv.UID,
 				Status:  string(pv.Status.Phase),
-				Message: fmt.Sprintf("PV %s is Available", pv.Name),
+				Message: fmt.Sprintf("PV %s is Available but not yet bound to PVC %s", pv.Name, pvc.Name),
 				Reason:  "Available",
 			})
 			if *overallStatus != "failed" {
-				*overallStatus = "ready"
+				*overallStatus = "deploying"
 			}
 		case corev1.VolumeFailed:
 			log.Printf("[INFO] PV %s is in Failed state", pv.Name)
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "PV",
 				Name:    pv.Name,
+				UID:     pv.UID,
 				Status:  string(pv.Status.Phase),
 				Message: fmt.Sprintf("PV %s is in Failed state", pv.Name),
 				Reason:  "Failed",
@@ -55,6 +70,7 @@ func (pvChecker PVChecker) Check(ctx context.Context, clientset *kubernetes.Clie
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "PV",
 				Name:    pv.Name,
+				UID:     pv.UID,
 				Status:  string(pv.Status.Phase),
 				Message: fmt.Sprintf("PV %s is in Released state", pv.Name),
 				Reason:  "Released",
@@ -67,6 +83,7 @@ func (pvChecker PVChecker) Check(ctx context.Context, clientset *kubernetes.Clie
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "PV",
 				Name:    pv.Name,
+				UID:     pv.UID,
 				Status:  string(pv.Status.Phase),
 				Message: fmt.Sprintf("PV %s is in an unexpected state: %s", pv.Name, pv.Status.Phase),
 				Reason:  "Unknown",
@@ -79,3 +96,17 @@ func (pvChecker PVChecker) Check(ctx context.Context, clientset *kubernetes.Clie
 
 	return nil
 }
+
+// isClaimedBy reports whether the PV belongs to the PVC, either through the
+// PVC's spec.volumeName alone, as for a pre-bound PVC whose PV has no claimRef
+// yet, or through a claimRef that points back at the PVC.
+func isClaimedBy(pv corev1.PersistentVolume, pvc corev1.PersistentVolumeClaim) bool {
+	if pvc.Spec.VolumeName != pv.Name {
+		return false
+	}
+	ref := pv.Spec.ClaimRef
+	if ref == nil {
+		return true
+	}
+	return ref.Namespace == pvc.Namespace && ref.Name == pvc.Name && (ref.UID == "" || ref.UID == pvc.UID)
+}
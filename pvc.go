@@ -4,35 +4,125 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
 )
 
-type PVCChecker struct{}
+type PVCChecker struct {
+	// ResizeTimeout is how long a volume expansion may stay in progress
+	// before it is reported as stuck.
+	ResizeTimeout time.Duration
+	// ProvisioningTimeout is how long after its creation a Pending PVC with
+	// ProvisioningFailed Events is still considered to be retrying.
+	ProvisioningTimeout time.Duration
+	// EventLookback is how far back ProvisioningFailed Events are considered.
+	EventLookback time.Duration
+}
+
+const (
+	// selectedNodeAnnotation is set by the scheduler on PVCs of
+	// WaitForFirstConsumer classes once their first consumer is scheduled.
+	selectedNodeAnnotation = "volume.kubernetes.io/selected-node"
+	// defaultStorageClassAnnotation marks the cluster's default StorageClass.
+	defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+)
 
 func (pvcChecker PVCChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
-	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	pvcs, err := listPVCs(ctx, clientset, namespace, labelSelector)
 	if err != nil {
 		return fmt.Errorf("error listing PVCs: %v", err)
 	}
 
-	for _, pvc := range pvcs.Items {
-		if !matchAnnotations(pvc.Annotations, annotationSelector) {
+	storageClasses := make(map[string]*storagev1.StorageClass)
+	for _, pvc := range pvcs {
+		if !isSelected(ctx, &pvc, annotationSelector) {
 			continue
 		}
 		log.Printf("[INFO] PVC status: name=%s, phase=%s", pvc.Name, pvc.Status.Phase)
 
 		switch pvc.Status.Phase {
 		case corev1.ClaimBound:
+			if message, reason, failed := pvcChecker.getResizeIssue(pvc); reason != "" {
+				log.Printf("[INFO] PVC %s resize: %s", pvc.Name, reason)
+				*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+					Kind:    "PVC",
+					Name:    pvc.Name,
+					UID:     pvc.UID,
+					Status:  string(pvc.Status.Phase),
+					Message: message,
+					Reason:  reason,
+				})
+				if failed {
+					*overallStatus = "failed"
+				} else if *overallStatus != "failed" {
+					*overallStatus = "deploying"
+				}
+				continue
+			}
 			log.Printf("[INFO] PVC %s is Healthy", pvc.Name)
 			continue
 		case corev1.ClaimPending:
 			log.Printf("[INFO] PVC %s is Pending", pvc.Name)
+			storageClass, err := getPVCStorageClass(ctx, clientset, pvc, storageClasses)
+			if err != nil {
+				return err
+			}
+			className := getPVCStorageClassName(pvc)
+			if storageClass == nil && className != "" {
+				*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+					Kind:    "PVC",
+					Name:    pvc.Name,
+					UID:     pvc.UID,
+					Status:  string(pvc.Status.Phase),
+					Message: fmt.Sprintf("PVC %s references StorageClass %s which does not exist", pvc.Name, className),
+					Reason:  "StorageClassNotFound",
+				})
+				*overallStatus = "failed"
+				continue
+			}
+
+			event, failures, err := getProvisioningFailures(ctx, clientset, pvc, pvcChecker.EventLookback)
+			if err != nil {
+				return err
+			}
+			if event != nil {
+				*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+					Kind:    "PVC",
+					Name:    pvc.Name,
+					UID:     pvc.UID,
+					Status:  string(pvc.Status.Phase),
+					Message: fmt.Sprintf("PVC %s failed to provision (%d times): %s", pvc.Name, failures, event.Message),
+					Reason:  event.Reason,
+				})
+				// The provisioner retries with a back-off, so failures only escalate
+				// once they keep being recorded past the provisioning timeout
+				if time.Since(pvc.CreationTimestamp.Time) > pvcChecker.ProvisioningTimeout {
+					*overallStatus = "failed"
+				} else if *overallStatus != "failed" {
+					*overallStatus = "deploying"
+				}
+				continue
+			}
+
+			// Volumes of WaitForFirstConsumer classes are only provisioned once a
+			// Pod using the PVC has been scheduled, so Pending is expected until then
+			if storageClass != nil && storageClass.VolumeBindingMode != nil &&
+				*storageClass.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer &&
+				pvc.Annotations[selectedNodeAnnotation] == "" {
+				log.Printf("[INFO] PVC %s is waiting for its first consumer", pvc.Name)
+				continue
+			}
+
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "PVC",
 				Name:    pvc.Name,
+				UID:     pvc.UID,
 				Status:  string(pvc.Status.Phase),
 				Message: fmt.Sprintf("PVC %s is Pending", pvc.Name),
 				Reason:  "Pending",
@@ -45,6 +135,7 @@ func (pvcChecker PVCChecker) Check(ctx context.Context, clientset *kubernetes.Cl
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "PVC",
 				Name:    pvc.Name,
+				UID:     pvc.UID,
 				Status:  string(pvc.Status.Phase),
 				Message: fmt.Sprintf("PVC %s is in Lost state", pvc.Name),
 				Reason:  "Lost",
@@ -55,6 +146,7 @@ func (pvcChecker PVCChecker) Check(ctx context.Context, clientset *kubernetes.Cl
 			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
 				Kind:    "PVC",
 				Name:    pvc.Name,
+				UID:     pvc.UID,
 				Status:  string(pvc.Status.Phase),
 				Message: fmt.Sprintf("PVC %s is in an unexpected state: %s", pvc.Name, pvc.Status.Phase),
 				Reason:  "Unknown",
@@ -65,3 +157,135 @@ func (pvcChecker PVCChecker) Check(ctx context.Context, clientset *kubernetes.Cl
 
 	return nil
 }
+
+// getPVCStorageClassName returns the StorageClass requested by the PVC, falling
+// back to the deprecated beta annotation.
+func getPVCStorageClassName(pvc corev1.PersistentVolumeClaim) string {
+	if pvc.Spec.StorageClassName != nil {
+		return *pvc.Spec.StorageClassName
+	}
+	return pvc.Annotations[corev1.BetaStorageClassAnnotation]
+}
+
+// getPVCStorageClass resolves the StorageClass of the PVC, using the default
+// class when none is requested. It returns nil if the class does not exist or
+// the PVC explicitly opts out of dynamic provisioning. Lookups are cached in
+// storageClasses for the duration of a check.
+func getPVCStorageClass(ctx context.Context, clientset *kubernetes.Clientset, pvc corev1.PersistentVolumeClaim, storageClasses map[string]*storagev1.StorageClass) (*storagev1.StorageClass, error) {
+	name := getPVCStorageClassName(pvc)
+	if pvc.Spec.StorageClassName != nil && name == "" {
+		return nil, nil
+	}
+	if storageClass, cached := storageClasses[name]; cached {
+		return storageClass, nil
+	}
+
+	var storageClass *storagev1.StorageClass
+	if name == "" {
+		classes, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error listing StorageClasses: %v", err)
+		}
+		for i := range classes.Items {
+			if classes.Items[i].Annotations[defaultStorageClassAnnotation] == "true" {
+				storageClass = &classes.Items[i]
+				break
+			}
+		}
+	} else {
+		class, err := clientset.StorageV1().StorageClasses().Get(ctx, name, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("error getting StorageClass %s: %v", name, err)
+		}
+		if err == nil {
+			storageClass = class
+		}
+	}
+
+	storageClasses[name] = storageClass
+	return storageClass, nil
+}
+
+// getProvisioningFailures returns the most recent ProvisioningFailed Event
+// recorded by the provisioner for the PVC within the lookback, together with
+// the number of failures those Events account for.
+func getProvisioningFailures(ctx context.Context, clientset *kubernetes.Clientset, pvc corev1.PersistentVolumeClaim, lookback time.Duration) (*corev1.Event, int32, error) {
+	events, err := clientset.CoreV1().Events(pvc.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "PersistentVolumeClaim",
+			"involvedObject.name": pvc.Name,
+			"involvedObject.uid":  string(pvc.UID),
+			"reason":              "ProvisioningFailed",
+		}.AsSelector().String(),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listing Events of PVC %s: %v", pvc.Name, err)
+	}
+
+	var latest *corev1.Event
+	var failures int32
+	for i := range events.Items {
+		event := &events.Items[i]
+		if time.Since(getEventTime(*event)) > lookback {
+			continue
+		}
+		switch {
+		case event.Series != nil && event.Series.Count > 0:
+			failures += event.Series.Count
+		case event.Count > 0:
+			failures += event.Count
+		default:
+			failures++
+		}
+		if latest == nil || getEventTime(*event).After(getEventTime(*latest)) {
+			latest = event
+		}
+	}
+	return latest, failures, nil
+}
+
+// getResizeIssue reports an in-flight, stuck or failed volume expansion of a
+// bound PVC. An empty reason means the PVC has the capacity it requested.
+func (pvcChecker PVCChecker) getResizeIssue(pvc corev1.PersistentVolumeClaim) (message, reason string, failed bool) {
+	if status, exists := pvc.Status.AllocatedResourceStatuses[corev1.ResourceStorage]; exists {
+		switch status {
+		case corev1.PersistentVolumeClaimControllerResizeFailed, corev1.PersistentVolumeClaimNodeResizeFailed:
+			return fmt.Sprintf("PVC %s resize failed: %s", pvc.Name, status), "ResizeFailed", true
+		}
+	}
+
+	for _, conditionType := range []corev1.PersistentVolumeClaimConditionType{corev1.PersistentVolumeClaimResizing, corev1.PersistentVolumeClaimFileSystemResizePending} {
+		condition := getPVCCondition(pvc, conditionType)
+		if condition == nil || condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		message = fmt.Sprintf("PVC %s is %s since %s", pvc.Name, conditionType, condition.LastTransitionTime.Format(time.RFC3339))
+		if condition.Message != "" {
+			message = fmt.Sprintf("%s: %s", message, condition.Message)
+		}
+		if pvcChecker.ResizeTimeout > 0 && time.Since(condition.LastTransitionTime.Time) > pvcChecker.ResizeTimeout {
+			return message, "ResizeStuck", true
+		}
+		return message, string(conditionType), false
+	}
+
+	if status, exists := pvc.Status.AllocatedResourceStatuses[corev1.ResourceStorage]; exists {
+		return fmt.Sprintf("PVC %s resize in progress: %s", pvc.Name, status), string(status), false
+	}
+
+	requested, hasRequest := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	capacity, hasCapacity := pvc.Status.Capacity[corev1.ResourceStorage]
+	if hasRequest && hasCapacity && capacity.Cmp(requested) < 0 {
+		return fmt.Sprintf("PVC %s has capacity %s but requests %s", pvc.Name, capacity.String(), requested.String()), "CapacityMismatch", false
+	}
+	return "", "", false
+}
+
+func getPVCCondition(pvc corev1.PersistentVolumeClaim, conditionType corev1.PersistentVolumeClaimConditionType) *corev1.PersistentVolumeClaimCondition {
+	for i := range pvc.Status.Conditions {
+		if pvc.Status.Conditions[i].Type == conditionType {
+			return &pvc.Status.Conditions[i]
+		}
+	}
+	return nil
+}
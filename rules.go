@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HealthRule is a CEL expression evaluated against the custom resource as
+// `self` and its children as `children`, e.g.
+// `self.status.replicas == self.spec.replicas && children.pods.all(p, p.ready)`.
+type HealthRule struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	// Status is the overall status applied when the rule does not hold:
+	// "deploying" (default) or "failed".
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	program cel.Program
+}
+
+// ruleChildKinds maps the keys of the `children` variable to the kinds used
+// in UnhealthyChild.
+var ruleChildKinds = map[string]string{
+	"pods":                     "Pod",
+	"deployments":              "Deployment",
+	"statefulsets":             "StatefulSet",
+	"daemonsets":               "DaemonSet",
+	"services":                 "Service",
+	"ingresses":                "Ingress",
+	"jobs":                     "Job",
+	"cronjobs":                 "CronJob",
+	"persistentvolumeclaims":   "PVC",
+	"horizontalpodautoscalers": "HorizontalPodAutoscaler",
+}
+
+func compileHealthRule(rule *HealthRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("health rule without a name")
+	}
+	if rule.Status != "" && rule.Status != "deploying" && rule.Status != "failed" {
+		return fmt.Errorf("health rule %s has invalid status %q", rule.Name, rule.Status)
+	}
+	env, err := cel.NewEnv(
+		cel.Variable("self", cel.DynType),
+		cel.Variable("children", cel.MapType(cel.StringType, cel.ListType(cel.DynType))),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating CEL environment: %v", err)
+	}
+	ast, issues := env.Compile(rule.Expression)
+	if issues != nil && issues.Err() != nil {
+		return fmt.Errorf("error compiling health rule %s: %v", rule.Name, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return fmt.Errorf("health rule %s must evaluate to a bool, got %v", rule.Name, ast.OutputType())
+	}
+	rule.program, err = env.Program(ast)
+	if err != nil {
+		return fmt.Errorf("error building health rule %s: %v", rule.Name, err)
+	}
+	return nil
+}
+
+// RuleChecker evaluates the CEL rules of a health policy. It runs after the
+// required and optional checkers so that each child exposes a `ready` field
+// that is false when one of them reported it as unhealthy.
+type RuleChecker struct {
+	CustomResource unstructured.Unstructured
+	Rules          []HealthRule
+	// Kinds are the child kinds evaluated by the policy, or nil for all.
+	// Children of other kinds are left out of `children` since no checker
+	// decided whether they are ready.
+	Kinds map[string]struct{}
+}
+
+// evaluates reports whether the children under a key of `children` are
+// exposed to the rules.
+func (rc RuleChecker) evaluates(key string) bool {
+	if rc.Kinds == nil {
+		return true
+	}
+	_, exists := rc.Kinds[ruleChildKinds[key]]
+	return exists
+}
+
+func (rc RuleChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
+	objects, err := rc.listChildren(ctx, clientset, namespace, labelSelector, annotationSelector)
+	if err != nil {
+		return err
+	}
+
+	unhealthy := make(map[string]struct{})
+	for _, child := range *unhealthyChildren {
+		unhealthy[string(child.UID)] = struct{}{}
+	}
+
+	children := make(map[string]interface{})
+	for key, kind := range ruleChildKinds {
+		if !rc.evaluates(key) {
+			continue
+		}
+		items := []interface{}{}
+		for _, obj := range objects[key] {
+			fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+			if err != nil {
+				return fmt.Errorf("error converting %s for health rules: %v", kind, err)
+			}
+			uid, _, _ := unstructured.NestedString(fields, "metadata", "uid")
+			_, isUnhealthy := unhealthy[uid]
+			fields["ready"] = !isUnhealthy
+			items = append(items, fields)
+		}
+		children[key] = items
+	}
+
+	for _, rule := range rc.Rules {
+		result, _, err := rule.program.Eval(map[string]interface{}{
+			"self":     rc.CustomResource.Object,
+			"children": children,
+		})
+		var message, reason string
+		switch {
+		case err != nil:
+			message = fmt.Sprintf("Health rule %s could not be evaluated: %v", rule.Name, err)
+			reason = "RuleError"
+		case result.Type() != types.BoolType:
+			message = fmt.Sprintf("Health rule %s evaluated to %v instead of a bool", rule.Name, result)
+			reason = "RuleError"
+		case result.Value() == false:
+			message = rule.Message
+			if message == "" {
+				message = fmt.Sprintf("Health rule %s does not hold: %s", rule.Name, rule.Expression)
+			}
+			reason = "RuleNotSatisfied"
+		}
+		log.Printf("[INFO] Health rule status: name=%s, result=%v, reason=%s", rule.Name, result, reason)
+
+		if reason == "" {
+			continue
+		}
+
+		status := "deploying"
+		if reason == "RuleNotSatisfied" && rule.Status == "failed" {
+			status = "failed"
+		}
+		*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+			Kind:    "HealthRule",
+			Name:    rule.Name,
+			Status:  "NotSatisfied",
+			Message: message,
+			Reason:  reason,
+		})
+		if status == "failed" {
+			*overallStatus = "failed"
+		} else if *overallStatus != "failed" {
+			*overallStatus = "deploying"
+		}
+	}
+
+	return nil
+}
+
+// listChildren lists the selected children exposed to health rules, keyed
+// like the `children` variable.
+func (rc RuleChecker) listChildren(ctx context.Context, clientset *kubernetes.Clientset, namespace, labelSelector, annotationSelector string) (map[string][]runtime.Object, error) {
+	objects := make(map[string][]runtime.Object)
+	add := func(key string, obj interface {
+		metav1.Object
+		runtime.Object
+	}) {
+		if isSelected(ctx, obj, annotationSelector) {
+			objects[key] = append(objects[key], obj)
+		}
+	}
+
+	if rc.evaluates("pods") {
+		pods, err := listPods(ctx, clientset, namespace, labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error listing Pods: %v", err)
+		}
+		for i := range pods {
+			add("pods", &pods[i])
+		}
+	}
+	if rc.evaluates("deployments") {
+		deployments, err := listDeployments(ctx, clientset, namespace, labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error listing Deployments: %v", err)
+		}
+		for i := range deployments {
+			add("deployments", &deployments[i])
+		}
+	}
+	if rc.evaluates("statefulsets") {
+		statefulSets, err := listStatefulSets(ctx, clientset, namespace, labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error listing StatefulSets: %v", err)
+		}
+		for i := range statefulSets {
+			add("statefulsets", &statefulSets[i])
+		}
+	}
+	if rc.evaluates("daemonsets") {
+		daemonSets, err := listDaemonSets(ctx, clientset, namespace, labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error listing DaemonSets: %v", err)
+		}
+		for i := range daemonSets {
+			add("daemonsets", &daemonSets[i])
+		}
+	}
+	if rc.evaluates("services") {
+		services, err := listServices(ctx, clientset, namespace, labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error listing Services: %v", err)
+		}
+		for i := range services {
+			add("services", &services[i])
+		}
+	}
+	if rc.evaluates("ingresses") {
+		ingresses, err := listIngresses(ctx, clientset, namespace, labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error listing Ingresses: %v", err)
+		}
+		for i := range ingresses {
+			add("ingresses", &ingresses[i])
+		}
+	}
+	if rc.evaluates("jobs") {
+		jobs, err := listJobs(ctx, clientset, namespace, labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error listing Jobs: %v", err)
+		}
+		for i := range jobs {
+			add("jobs", &jobs[i])
+		}
+	}
+	if rc.evaluates("cronjobs") {
+		cronJobs, err := listCronJobs(ctx, clientset, namespace, labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error listing CronJobs: %v", err)
+		}
+		for i := range cronJobs {
+			add("cronjobs", &cronJobs[i])
+		}
+	}
+	if rc.evaluates("persistentvolumeclaims") {
+		pvcs, err := listPVCs(ctx, clientset, namespace, labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error listing PVCs: %v", err)
+		}
+		for i := range pvcs {
+			add("persistentvolumeclaims", &pvcs[i])
+		}
+	}
+	if rc.evaluates("horizontalpodautoscalers") {
+		hpas, err := listHPAs(ctx, clientset, namespace, labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("error listing HorizontalPodAutoscalers: %v", err)
+		}
+		for i := range hpas {
+			add("horizontalpodautoscalers", &hpas[i])
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+type ServiceChecker struct{}
+
+func (sc ServiceChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
+	services, err := listServices(ctx, clientset, namespace, labelSelector)
+	if err != nil {
+		return fmt.Errorf("error listing Services: %v", err)
+	}
+
+	for _, svc := range services {
+		if !isSelected(ctx, &svc, annotationSelector) {
+			continue
+		}
+		if svc.Spec.Type == corev1.ServiceTypeExternalName {
+			continue
+		}
+
+		readyEndpoints, err := countReadyEndpoints(ctx, clientset, svc)
+		if err != nil {
+			return err
+		}
+		log.Printf("[INFO] Service status: name=%s, type=%s, readyEndpoints=%d", svc.Name, svc.Spec.Type, readyEndpoints)
+
+		if readyEndpoints == 0 {
+			message := fmt.Sprintf("Service %s has no ready endpoints", svc.Name)
+			reason := "NoReadyEndpoints"
+			if len(svc.Spec.Selector) > 0 {
+				pods, err := listPods(ctx, clientset, namespace, labels.SelectorFromSet(svc.Spec.Selector).String())
+				if err != nil {
+					return fmt.Errorf("error listing Pods of Service %s: %v", svc.Name, err)
+				}
+				if len(pods) == 0 {
+					message = fmt.Sprintf("Service %s selector %s matches no Pods", svc.Name, labels.SelectorFromSet(svc.Spec.Selector).String())
+					reason = "NoMatchingPods"
+				}
+			}
+			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+				Kind:    "Service",
+				Name:    svc.Name,
+				UID:     svc.UID,
+				Status:  "NotReady",
+				Message: message,
+				Reason:  reason,
+			})
+			if *overallStatus != "failed" {
+				*overallStatus = "deploying"
+			}
+			continue
+		}
+
+		if svc.Spec.Type == corev1.ServiceTypeLoadBalancer && !hasLoadBalancerIngress(svc.Status.LoadBalancer.Ingress) {
+			*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+				Kind:    "Service",
+				Name:    svc.Name,
+				UID:     svc.UID,
+				Status:  "Pending",
+				Message: fmt.Sprintf("Service %s is waiting for a load balancer address", svc.Name),
+				Reason:  "LoadBalancerPending",
+			})
+			if *overallStatus != "failed" {
+				*overallStatus = "deploying"
+			}
+			continue
+		}
+
+		log.Printf("[INFO] Service %s is Healthy", svc.Name)
+	}
+
+	return nil
+}
+
+func countReadyEndpoints(ctx context.Context, clientset *kubernetes.Clientset, svc corev1.Service) (int, error) {
+	slices, err := clientset.DiscoveryV1().EndpointSlices(svc.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: svc.Name}).String(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error listing EndpointSlices of Service %s: %v", svc.Name, err)
+	}
+
+	ready := 0
+	for _, slice := range slices.Items {
+		for _, endpoint := range slice.Endpoints {
+			// A nil Ready condition must be interpreted as ready
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				ready++
+			}
+		}
+	}
+	return ready, nil
+}
+
+func hasLoadBalancerIngress(ingress []corev1.LoadBalancerIngress) bool {
+	for _, entry := range ingress {
+		if entry.IP != "" || entry.Hostname != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type StatefulSetChecker struct{}
+
+func (sc StatefulSetChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
+	statefulSets, err := listStatefulSets(ctx, clientset, namespace, labelSelector)
+	if err != nil {
+		return fmt.Errorf("error listing StatefulSets: %v", err)
+	}
+
+	for _, sts := range statefulSets {
+		if !isSelected(ctx, &sts, annotationSelector) {
+			continue
+		}
+		desired := int32(1)
+		if sts.Spec.Replicas != nil {
+			desired = *sts.Spec.Replicas
+		}
+		partition := int32(0)
+		if sts.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType &&
+			sts.Spec.UpdateStrategy.RollingUpdate != nil && sts.Spec.UpdateStrategy.RollingUpdate.Partition != nil {
+			partition = *sts.Spec.UpdateStrategy.RollingUpdate.Partition
+		}
+		log.Printf("[INFO] StatefulSet status: name=%s, desired=%d, ready=%d, updated=%d, partition=%d, currentRevision=%s, updateRevision=%s",
+			sts.Name, desired, sts.Status.ReadyReplicas, sts.Status.UpdatedReplicas, partition, sts.Status.CurrentRevision, sts.Status.UpdateRevision)
+
+		if sts.Status.ObservedGeneration < sts.Generation {
+			appendStatefulSetChild(unhealthyChildren, overallStatus, sts, fmt.Sprintf("StatefulSet %s spec update not yet observed by the controller", sts.Name), "GenerationNotObserved")
+			continue
+		}
+
+		rollingOut := sts.Status.UpdateRevision != "" && sts.Status.UpdateRevision != sts.Status.CurrentRevision
+		expectedUpdated := desired - partition
+		if expectedUpdated < 0 {
+			expectedUpdated = 0
+		}
+		if sts.Status.ReadyReplicas >= desired && (!rollingOut || sts.Status.UpdatedReplicas >= expectedUpdated) {
+			if rollingOut && partition > 0 {
+				log.Printf("[INFO] StatefulSet %s is Healthy, rollout paused at partition %d", sts.Name, partition)
+			} else {
+				log.Printf("[INFO] StatefulSet %s is Healthy", sts.Name)
+			}
+			continue
+		}
+
+		pods, err := getStatefulSetPods(ctx, clientset, sts)
+		if err != nil {
+			return err
+		}
+
+		ordinal, detail := findBlockingOrdinal(sts, pods, desired, partition, rollingOut)
+		if ordinal < 0 {
+			appendStatefulSetChild(unhealthyChildren, overallStatus, sts,
+				fmt.Sprintf("StatefulSet %s has %d of %d replicas ready and %d of %d updated", sts.Name, sts.Status.ReadyReplicas, desired, sts.Status.UpdatedReplicas, expectedUpdated),
+				"RollingOut")
+			continue
+		}
+
+		reason := "OrdinalNotReady"
+		if rollingOut {
+			reason = "RollingOut"
+		}
+		appendStatefulSetChild(unhealthyChildren, overallStatus, sts,
+			fmt.Sprintf("StatefulSet %s is blocked on ordinal %d (pod %s-%d): %s", sts.Name, ordinal, sts.Name, ordinal, detail),
+			reason)
+	}
+
+	return nil
+}
+
+func appendStatefulSetChild(unhealthyChildren *[]UnhealthyChild, overallStatus *string, sts appsv1.StatefulSet, message, reason string) {
+	*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+		Kind:    "StatefulSet",
+		Name:    sts.Name,
+		UID:     sts.UID,
+		Status:  "Progressing",
+		Message: message,
+		Reason:  reason,
+	})
+	if *overallStatus != "failed" {
+		*overallStatus = "deploying"
+	}
+}
+
+// getStatefulSetPods returns the Pods owned by the StatefulSet keyed by ordinal.
+func getStatefulSetPods(ctx context.Context, clientset *kubernetes.Clientset, sts appsv1.StatefulSet) (map[int32]corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing selector of StatefulSet %s: %v", sts.Name, err)
+	}
+	pods, err := listPods(ctx, clientset, sts.Namespace, selector.String())
+	if err != nil {
+		return nil, fmt.Errorf("error listing Pods of StatefulSet %s: %v", sts.Name, err)
+	}
+
+	podsByOrdinal := make(map[int32]corev1.Pod)
+	for _, pod := range pods {
+		owner := metav1.GetControllerOf(&pod)
+		if owner == nil || owner.UID != sts.UID {
+			continue
+		}
+		ordinal, err := strconv.ParseInt(strings.TrimPrefix(pod.Name, sts.Name+"-"), 10, 32)
+		if err != nil {
+			continue
+		}
+		podsByOrdinal[int32(ordinal)] = pod
+	}
+	return podsByOrdinal, nil
+}
+
+// findBlockingOrdinal mirrors the StatefulSet controller ordering: during a
+// rolling update Pods are replaced from the highest ordinal down to the
+// partition, otherwise Pods are brought up from ordinal 0 upwards.
+func findBlockingOrdinal(sts appsv1.StatefulSet, pods map[int32]corev1.Pod, desired, partition int32, rollingOut bool) (int32, string) {
+	if rollingOut {
+		for ordinal := desired - 1; ordinal >= partition; ordinal-- {
+			pod, exists := pods[ordinal]
+			if !exists {
+				return ordinal, "pod does not exist"
+			}
+			if pod.Labels[appsv1.StatefulSetRevisionLabel] != sts.Status.UpdateRevision {
+				return ordinal, fmt.Sprintf("waiting to be updated to revision %s", sts.Status.UpdateRevision)
+			}
+			if pod.Status.Phase != corev1.PodRunning || !isPodHealthy(pod) {
+				return ordinal, fmt.Sprintf("updated pod is %s and not ready", pod.Status.Phase)
+			}
+		}
+	}
+	for ordinal := int32(0); ordinal < desired; ordinal++ {
+		pod, exists := pods[ordinal]
+		if !exists {
+			return ordinal, "pod does not exist"
+		}
+		if pod.Status.Phase != corev1.PodRunning || !isPodHealthy(pod) {
+			return ordinal, fmt.Sprintf("pod is %s and not ready", pod.Status.Phase)
+		}
+	}
+	return -1, ""
+}
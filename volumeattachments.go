@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type VolumeAttachmentChecker struct {
+	// AttachTimeout is how long a VolumeAttachment may stay unattached before
+	// it is reported as stuck.
+	AttachTimeout time.Duration
+}
+
+func (vc VolumeAttachmentChecker) Check(ctx context.Context, clientset *kubernetes.Clientset, namespace, crdGroup, crdVersion, crdPlural, labelSelector, annotationSelector string, unhealthyChildren *[]UnhealthyChild, overallStatus *string) error {
+	pods, err := listPods(ctx, clientset, namespace, labelSelector)
+	if err != nil {
+		return fmt.Errorf("error listing Pods: %v", err)
+	}
+
+	pvcs, err := listPVCs(ctx, clientset, namespace, "")
+	if err != nil {
+		return fmt.Errorf("error listing PVCs: %v", err)
+	}
+	volumeByClaim := make(map[string]string)
+	for _, pvc := range pvcs {
+		volumeByClaim[pvc.Name] = pvc.Spec.VolumeName
+	}
+
+	// Map every PV used by scheduled Pods to their nodes and, per node, the
+	// Pods using it, since a ReadWriteMany volume can be attached to several
+	podsByVolume := make(map[string]map[string][]string)
+	for _, pod := range pods {
+		if !isSelected(ctx, &pod, annotationSelector) || pod.Spec.NodeName == "" {
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+			volumeName := volumeByClaim[volume.PersistentVolumeClaim.ClaimName]
+			if volumeName == "" {
+				continue
+			}
+			if podsByVolume[volumeName] == nil {
+				podsByVolume[volumeName] = make(map[string][]string)
+			}
+			podsByVolume[volumeName][pod.Spec.NodeName] = append(podsByVolume[volumeName][pod.Spec.NodeName], pod.Name)
+		}
+	}
+	if len(podsByVolume) == 0 {
+		return nil
+	}
+
+	attachments, err := clientset.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing VolumeAttachments: %v", err)
+	}
+
+	for _, va := range attachments.Items {
+		if va.Spec.Source.PersistentVolumeName == nil {
+			continue
+		}
+		pv := *va.Spec.Source.PersistentVolumeName
+		podsByNode, exists := podsByVolume[pv]
+		if !exists {
+			continue
+		}
+		podNames, onNode := podsByNode[va.Spec.NodeName]
+		consumers := fmt.Sprintf("Pod %s", strings.Join(podNames, ", "))
+		if len(podNames) > 1 {
+			consumers = fmt.Sprintf("Pods %s", strings.Join(podNames, ", "))
+		}
+		log.Printf("[INFO] VolumeAttachment status: name=%s, pv=%s, node=%s, attached=%t", va.Name, pv, va.Spec.NodeName, va.Status.Attached)
+
+		var message, reason string
+		status := "NotAttached"
+		failed := false
+		switch {
+		case va.Status.DetachError != nil:
+			message = fmt.Sprintf("VolumeAttachment %s failed to detach PV %s from node %s: %s", va.Name, pv, va.Spec.NodeName, va.Status.DetachError.Message)
+			reason = "DetachError"
+			status = "NotDetached"
+		case !onNode:
+			continue
+		case va.Status.AttachError != nil:
+			message = fmt.Sprintf("VolumeAttachment %s failed to attach PV %s to node %s for %s: %s", va.Name, pv, va.Spec.NodeName, consumers, va.Status.AttachError.Message)
+			reason = "AttachError"
+			failed = vc.AttachTimeout > 0 && time.Since(va.CreationTimestamp.Time) > vc.AttachTimeout
+		case !va.Status.Attached && vc.AttachTimeout > 0 && time.Since(va.CreationTimestamp.Time) > vc.AttachTimeout:
+			message = fmt.Sprintf("VolumeAttachment %s has not attached PV %s to node %s for %s since %s", va.Name, pv, va.Spec.NodeName, consumers, va.CreationTimestamp.Format(time.RFC3339))
+			reason = "AttachStuck"
+			failed = true
+		case !va.Status.Attached:
+			message = fmt.Sprintf("VolumeAttachment %s is attaching PV %s to node %s for %s", va.Name, pv, va.Spec.NodeName, consumers)
+			reason = "Attaching"
+		}
+
+		if reason == "" {
+			log.Printf("[INFO] VolumeAttachment %s is Healthy", va.Name)
+			continue
+		}
+
+		*unhealthyChildren = append(*unhealthyChildren, UnhealthyChild{
+			Kind:    "VolumeAttachment",
+			Name:    va.Name,
+			UID:     va.UID,
+			Status:  status,
+			Message: message,
+			Reason:  reason,
+		})
+		if failed {
+			*overallStatus = "failed"
+		} else if *overallStatus != "failed" {
+			*overallStatus = "deploying"
+		}
+	}
+
+	return nil
+}